@@ -0,0 +1,61 @@
+package raven
+
+// The default maximum size in bytes of an attachment.
+const defaultMaxAttachmentBytes = 1 << 20
+
+// An Attachment is a file sent along with the packet it is passed with, such
+// as a configuration dump or a log snippet, for example:
+//
+//	raven.CaptureError(err, nil, &raven.Attachment{
+//		Filename:    "config.json",
+//		ContentType: "application/json",
+//		Data:        config,
+//	})
+//
+// Attachments are only sent to the envelope endpoint, enabled by
+// SetUseEnvelope, and are left out of events sent to the store endpoint.
+//
+// https://develop.sentry.dev/sdk/envelopes/#attachment
+type Attachment struct {
+	Filename string
+
+	// Optional, Sentry assumes application/octet-stream when empty
+	ContentType string
+
+	Data []byte
+}
+
+func (a *Attachment) Class() string { return "attachment" }
+
+func (a *Attachment) apply(packet *Packet) { packet.attachments = append(packet.attachments, a) }
+
+// Attachments returns the attachments passed with the packet.
+func (packet *Packet) Attachments() []*Attachment { return packet.attachments }
+
+func SetMaxAttachmentBytes(n int) { DefaultClient.SetMaxAttachmentBytes(n) }
+
+// SetMaxAttachmentBytes sets the maximum size in bytes of the attachments of
+// packets. Larger attachments are left out of the packet rather than sent
+// truncated. The default size of 1MB is used when n is 0, and a negative n
+// removes the limit.
+func (client *Client) SetMaxAttachmentBytes(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxAttachmentBytes = n
+}
+
+// dropLargeAttachments leaves the attachments larger than n bytes out of the
+// packet.
+func (packet *Packet) dropLargeAttachments(n int) {
+	if n < 0 {
+		return
+	}
+	var attachments []*Attachment
+	for _, a := range packet.attachments {
+		if len(a.Data) <= n {
+			attachments = append(attachments, a)
+		}
+	}
+	packet.attachments = attachments
+}
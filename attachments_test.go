@@ -0,0 +1,73 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentEnvelope(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	client, err := New(strings.Replace(server.URL, "http://", "http://public@", 1) + "/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = &HTTPTransport{Client: &http.Client{}, CompressionThreshold: -1}
+	client.SetUseEnvelope(true)
+
+	log := []byte("12:00:01 connecting\n12:00:02 connection refused")
+	client.CaptureErrorAndWait(errors.New("boom"), nil, &Attachment{Filename: "app.log", ContentType: "text/plain", Data: log})
+
+	// The envelope header, the event item and the attachment item, each
+	// made of a header line and a payload
+	lines := bytes.SplitN(body, []byte("\n"), 4)
+	if len(lines) != 4 {
+		t.Fatalf("incorrect envelope: got %s", body)
+	}
+	if bytes.Contains(lines[2], []byte(`"attachment"`)) {
+		t.Errorf("attachment was sent as an interface: got %s", lines[2])
+	}
+	item := lines[3]
+	end := bytes.IndexByte(item, '\n')
+	if end == -1 {
+		t.Fatalf("incorrect attachment item: got %s", item)
+	}
+	var header struct {
+		Type        string `json:"type"`
+		Length      int    `json:"length"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+	}
+	if err := json.Unmarshal(item[:end], &header); err != nil {
+		t.Fatalf("invalid attachment header: %v", err)
+	}
+	if header.Type != "attachment" || header.Filename != "app.log" || header.ContentType != "text/plain" || header.Length != len(log) {
+		t.Errorf("incorrect attachment header: got %s", item[:end])
+	}
+	if payload := item[end+1:]; !bytes.Equal(payload, append(log, '\n')) {
+		t.Errorf("incorrect attachment payload: got %q", payload)
+	}
+}
+
+func TestSetMaxAttachmentBytes(t *testing.T) {
+	client, transport := NewTestClient()
+	client.SetMaxAttachmentBytes(4)
+
+	client.CaptureMessage("boom", nil, &Attachment{Filename: "small.txt", Data: []byte("1234")}, &Attachment{Filename: "large.txt", Data: []byte("12345")})
+	client.Wait()
+
+	attachments := transport.LastEvent().Attachments()
+	if len(attachments) != 1 || attachments[0].Filename != "small.txt" {
+		t.Errorf("incorrect attachments: got %+v", attachments)
+	}
+}
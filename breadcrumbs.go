@@ -0,0 +1,121 @@
+package raven
+
+import (
+	"time"
+)
+
+// The number of breadcrumbs kept by a client when SetMaxBreadcrumbs has not
+// been called.
+const defaultMaxBreadcrumbs = 30
+
+// A Breadcrumb records an event that happened before an error was captured,
+// such as a request being made or a message being logged.
+//
+// https://docs.sentry.io/clientdev/interfaces/breadcrumbs/
+type Breadcrumb struct {
+	Timestamp Timestamp `json:"timestamp"`
+
+	// Optional
+	Type     string                 `json:"type,omitempty"`
+	Category string                 `json:"category,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Level    Severity               `json:"level,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// https://docs.sentry.io/clientdev/interfaces/breadcrumbs/
+type Breadcrumbs struct {
+	Values []Breadcrumb `json:"values"`
+}
+
+func (b *Breadcrumbs) Class() string { return "breadcrumbs" }
+
+// A breadcrumbBuffer is a ring buffer holding the most recent breadcrumbs.
+type breadcrumbBuffer struct {
+	values []Breadcrumb
+	// The index of the oldest breadcrumb once the buffer is full
+	next int
+}
+
+func (b *breadcrumbBuffer) add(crumb Breadcrumb, max int) {
+	if max <= 0 {
+		b.values, b.next = nil, 0
+		return
+	}
+	if len(b.values) < max {
+		b.values = append(b.values, crumb)
+		return
+	}
+	b.values[b.next] = crumb
+	b.next = (b.next + 1) % len(b.values)
+}
+
+// list returns the breadcrumbs in the buffer, oldest first.
+func (b *breadcrumbBuffer) list() []Breadcrumb {
+	if len(b.values) == 0 {
+		return nil
+	}
+	list := make([]Breadcrumb, 0, len(b.values))
+	list = append(list, b.values[b.next:]...)
+	return append(list, b.values[:b.next]...)
+}
+
+// resize keeps at most the max most recent breadcrumbs.
+func (b *breadcrumbBuffer) resize(max int) {
+	list := b.list()
+	if max <= 0 {
+		list = nil
+	} else if len(list) > max {
+		list = list[len(list)-max:]
+	}
+	b.values, b.next = list, 0
+}
+
+func AddBreadcrumb(crumb Breadcrumb) { DefaultClient.AddBreadcrumb(crumb) }
+
+// AddBreadcrumb records a breadcrumb to be attached to the packets captured
+// by the client, dropping the oldest one when the client already holds as
+// many as SetMaxBreadcrumbs allows. The Timestamp defaults to the current
+// time.
+//
+// Breadcrumbs are kept for the client as a whole rather than per goroutine or
+// request, so in a concurrent program a packet may carry breadcrumbs recorded
+// by unrelated work.
+func (client *Client) AddBreadcrumb(crumb Breadcrumb) {
+	if client == nil {
+		return
+	}
+	if time.Time(crumb.Timestamp).IsZero() {
+		crumb.Timestamp = Timestamp(time.Now().UTC())
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.breadcrumbs.add(crumb, client.maxBreadcrumbs)
+}
+
+func SetMaxBreadcrumbs(max int) { DefaultClient.SetMaxBreadcrumbs(max) }
+
+// SetMaxBreadcrumbs sets the number of the most recent breadcrumbs the client
+// keeps, which defaults to 30. Zero disables breadcrumbs.
+func (client *Client) SetMaxBreadcrumbs(max int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxBreadcrumbs = max
+	client.breadcrumbs.resize(max)
+}
+
+// breadcrumbsInterface returns the client's breadcrumbs as an interface to
+// attach to a packet, or nil if it has none.
+func (client *Client) breadcrumbsInterface() Interface {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	values := client.breadcrumbs.list()
+	if len(values) == 0 {
+		return nil
+	}
+	return &Breadcrumbs{Values: values}
+}
@@ -0,0 +1,79 @@
+package raven
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBreadcrumbBuffer(t *testing.T) {
+	var b breadcrumbBuffer
+	for i := 0; i < 5; i++ {
+		b.add(Breadcrumb{Message: strconv.Itoa(i)}, 3)
+	}
+	assertBreadcrumbs(t, b.list(), "2", "3", "4")
+
+	b.resize(2)
+	assertBreadcrumbs(t, b.list(), "3", "4")
+	b.add(Breadcrumb{Message: "5"}, 2)
+	assertBreadcrumbs(t, b.list(), "4", "5")
+
+	b.resize(0)
+	assertBreadcrumbs(t, b.list())
+}
+
+func TestCaptureBreadcrumbs(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.SetMaxBreadcrumbs(2)
+	client.AddBreadcrumb(Breadcrumb{Category: "http", Message: "GET /"})
+	client.AddBreadcrumb(Breadcrumb{Category: "sql", Message: "SELECT 1"})
+	client.AddBreadcrumb(Breadcrumb{Category: "log", Message: "retrying", Level: WARNING})
+	client.Capture(NewPacket("boom"), nil)
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	var breadcrumbs *Breadcrumbs
+	for _, inter := range packets[0].Interfaces {
+		if b, ok := inter.(*Breadcrumbs); ok {
+			breadcrumbs = b
+		}
+	}
+	if breadcrumbs == nil {
+		t.Fatal("packet has no breadcrumbs")
+	}
+	assertBreadcrumbs(t, breadcrumbs.Values, "SELECT 1", "retrying")
+	for _, b := range breadcrumbs.Values {
+		if time.Time(b.Timestamp).IsZero() {
+			t.Errorf("breadcrumb %q has no timestamp", b.Message)
+		}
+	}
+}
+
+func TestCaptureWithoutBreadcrumbs(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.SetMaxBreadcrumbs(0)
+	client.AddBreadcrumb(Breadcrumb{Message: "ignored"})
+	client.Capture(NewPacket("boom"), nil)
+	client.Wait()
+
+	for _, inter := range transport.Packets()[0].Interfaces {
+		if _, ok := inter.(*Breadcrumbs); ok {
+			t.Error("unexpected breadcrumbs in packet")
+		}
+	}
+}
+
+func assertBreadcrumbs(t *testing.T, actual []Breadcrumb, expected ...string) {
+	if len(actual) != len(expected) {
+		t.Errorf("incorrect number of breadcrumbs: got %d, want %d", len(actual), len(expected))
+		return
+	}
+	for i, message := range expected {
+		if actual[i].Message != message {
+			t.Errorf("incorrect breadcrumb %d: got %s, want %s", i, actual[i].Message, message)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package raven
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("raven: circuit open after repeated failures")
+
+// The CircuitThreshold and CircuitCooldown used when they are zero.
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+)
+
+// A CircuitState is the state of the circuit breaker of an HTTPTransport for a
+// URL.
+type CircuitState int
+
+const (
+	// Events are sent
+	CircuitClosed CircuitState = iota
+
+	// Events are dropped with ErrCircuitOpen until the cooldown is over
+	CircuitOpen
+
+	// The cooldown is over, and the next event probes the server
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// A circuit counts the consecutive failed sends to a URL.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+
+	// Whether a send is probing the server after the cooldown
+	probing bool
+}
+
+func (t *HTTPTransport) circuitThreshold() int {
+	if t.CircuitThreshold == 0 {
+		return defaultCircuitThreshold
+	}
+	return t.CircuitThreshold
+}
+
+// CircuitState returns the state of the circuit breaker for url.
+func (t *HTTPTransport) CircuitState(url string) CircuitState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.circuits[url]
+	switch {
+	case c == nil || c.failures < t.circuitThreshold() || t.circuitThreshold() < 0:
+		return CircuitClosed
+	case timeNow().Before(c.openUntil) || c.probing:
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
+
+// allowSend reports whether a packet may be sent to url, letting a single send
+// through to probe the server once the circuit's cooldown is over.
+func (t *HTTPTransport) allowSend(url string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.circuits[url]
+	threshold := t.circuitThreshold()
+	if c == nil || threshold < 0 || c.failures < threshold {
+		return true
+	}
+	if timeNow().Before(c.openUntil) || c.probing {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// recordSend records the outcome of a send to url. Only failures suggesting
+// that the server is down count towards opening the circuit, and any other
+// outcome closes it. An aborted send, which says nothing about the server,
+// leaves the count as it is.
+func (t *HTTPTransport) recordSend(url string, failed, aborted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.circuits[url]
+	switch {
+	case aborted:
+		if c != nil {
+			c.probing = false
+		}
+		return
+	case !failed:
+		delete(t.circuits, url)
+		return
+	}
+
+	if c == nil {
+		if t.circuits == nil {
+			t.circuits = make(map[string]*circuit)
+		}
+		c = &circuit{}
+		t.circuits[url] = c
+	}
+	c.failures++
+	c.probing = false
+	if threshold := t.circuitThreshold(); threshold > 0 && c.failures >= threshold {
+		cooldown := t.CircuitCooldown
+		if cooldown == 0 {
+			cooldown = defaultCircuitCooldown
+		}
+		c.openUntil = timeNow().Add(cooldown)
+	}
+}
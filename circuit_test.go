@@ -0,0 +1,87 @@
+package raven
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPTransportCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	var mu sync.Mutex
+	requests, status := 0, 500
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	transport := &HTTPTransport{Client: &http.Client{}, CircuitThreshold: 2, CircuitCooldown: time.Minute}
+	send := func(expectedState CircuitState, expectedRequests int) error {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+
+		packet := NewPacket("boom")
+		packet.Init("1")
+		err := transport.Send(server.URL, "auth", packet)
+		if state := transport.CircuitState(server.URL); state != expectedState {
+			t.Errorf("incorrect state: got %s, want %s", state, expectedState)
+		}
+		mu.Lock()
+		if requests != expectedRequests {
+			t.Errorf("incorrect number of requests: got %d, want %d", requests, expectedRequests)
+		}
+		mu.Unlock()
+		return err
+	}
+
+	send(CircuitClosed, 1)
+	send(CircuitOpen, 1)
+	if err := send(CircuitOpen, 0); err != ErrCircuitOpen {
+		t.Errorf("incorrect error of an open circuit: got %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A failed probe opens the circuit again
+	now = now.Add(time.Minute)
+	if state := transport.CircuitState(server.URL); state != CircuitHalfOpen {
+		t.Errorf("incorrect state after the cooldown: got %s, want %s", state, CircuitHalfOpen)
+	}
+	send(CircuitOpen, 1)
+	send(CircuitOpen, 0)
+
+	now = now.Add(time.Minute)
+	mu.Lock()
+	status = 200
+	mu.Unlock()
+	if err := send(CircuitClosed, 1); err != nil {
+		t.Errorf("probe failed after recovery: got %v", err)
+	}
+	send(CircuitClosed, 1)
+}
+
+func TestHTTPTransportCircuitBreakerDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	transport := &HTTPTransport{Client: &http.Client{}, CircuitThreshold: -1}
+	for i := 0; i < defaultCircuitThreshold+1; i++ {
+		packet := NewPacket("boom")
+		packet.Init("1")
+		if err := transport.Send(server.URL, "auth", packet); err == ErrCircuitOpen {
+			t.Fatalf("circuit opened after %d failures", i)
+		}
+	}
+	if state := transport.CircuitState(server.URL); state != CircuitClosed {
+		t.Errorf("incorrect state: got %s, want %s", state, CircuitClosed)
+	}
+}
@@ -3,10 +3,10 @@ package raven
 
 import (
 	"bytes"
-	"compress/zlib"
+	"compress/gzip"
+	goctx "context"
 	"crypto/rand"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -14,6 +14,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	mathrand "math/rand"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,21 +27,51 @@ import (
 	"github.com/certifi/gocertifi"
 )
 
+// Version is the version of the package, which is sent along with every event.
+const Version = "1.0.0"
+
 const (
-	userAgent       = "raven-go/1.0"
-	timestampFormat = `"2006-01-02T15:04:05.00"`
+	sdkName         = "raven-go"
+	userAgent       = sdkName + "/" + Version
+	timestampFormat = `"2006-01-02T15:04:05.000Z"`
+
+	// The format of the timestamps sent by earlier versions, which are
+	// still accepted when unmarshalling
+	legacyTimestampFormat = `"2006-01-02T15:04:05.00"`
+
+	// How far in the future a timestamp may be, allowing for clock skew
+	// between the host and Sentry, which rejects later ones
+	maxTimestampSkew = time.Minute
 )
 
 var (
 	ErrPacketDropped         = errors.New("raven: packet dropped")
+	ErrClientClosed          = errors.New("raven: client closed")
+	ErrRateLimited           = errors.New("raven: rate limited by the server")
 	ErrUnableToUnmarshalJSON = errors.New("raven: unable to unmarshal JSON")
+	ErrInvalidScheme         = errors.New("raven: dsn scheme should be http or https")
+	ErrMissingHost           = errors.New("raven: dsn missing host")
 	ErrMissingUser           = errors.New("raven: dsn missing public key and/or password")
-	ErrMissingPrivateKey     = errors.New("raven: dsn missing private key")
 	ErrMissingProjectID      = errors.New("raven: dsn missing project id")
+	ErrInvalidSampleRate     = errors.New("raven: sample rate should be between 0 and 1")
+	ErrMissingEventID        = errors.New("raven: payload missing a valid event_id")
+	ErrMissingDSN            = errors.New("raven: client has no dsn")
+	ErrUnauthorized          = errors.New("raven: dsn rejected by the server")
 )
 
+// ErrMissingPrivateKey was returned for DSNs without a secret key.
+//
+// Deprecated: the secret key is optional, so it is no longer returned.
+var ErrMissingPrivateKey = errors.New("raven: dsn missing private key")
+
+// The Severity of an event sets its level. It may be passed along with the
+// interfaces of a packet, to set its Level.
 type Severity string
 
+func (s Severity) Class() string { return "level" }
+
+func (s Severity) apply(packet *Packet) { packet.Level = s }
+
 // http://docs.python.org/2/howto/logging.html#logging-levels
 const (
 	DEBUG   = Severity("debug")
@@ -50,6 +81,9 @@ const (
 	FATAL   = Severity("fatal")
 )
 
+// A Timestamp is sent in UTC as an RFC 3339 date and time with millisecond
+// precision. A packet captured without one gets the current time, so it must
+// be set to report an event that happened earlier.
 type Timestamp time.Time
 
 func (t Timestamp) MarshalJSON() ([]byte, error) {
@@ -57,9 +91,12 @@ func (t Timestamp) MarshalJSON() ([]byte, error) {
 }
 
 func (timestamp *Timestamp) UnmarshalJSON(data []byte) error {
-	t, err := time.Parse(timestampFormat, string(data))
+	t, err := time.Parse(`"`+time.RFC3339+`"`, string(data))
 	if err != nil {
-		return err
+		var legacyErr error
+		if t, legacyErr = time.Parse(legacyTimestampFormat, string(data)); legacyErr != nil {
+			return err
+		}
 	}
 
 	*timestamp = Timestamp(t)
@@ -81,9 +118,19 @@ type Transport interface {
 	Send(url, authHeader string, packet *Packet) error
 }
 
+// A ContextTransport is a Transport which can abort sending a packet when a
+// context is done, as the packets captured by CaptureWithContext are.
+// Transports that are not are only given the packets whose context is not
+// done yet.
+type ContextTransport interface {
+	Transport
+	SendContext(ctx goctx.Context, url, authHeader string, packet *Packet) error
+}
+
 type outgoingPacket struct {
 	packet *Packet
 	ch     chan error
+	ctx    goctx.Context
 }
 
 type Tag struct {
@@ -139,7 +186,9 @@ type Packet struct {
 	// Required
 	Message string `json:"message"`
 
-	// Required, set automatically by Client.Send/Report via Packet.Init if blank
+	// Required, set automatically by Client.Send/Report via Packet.Init if blank.
+	// A Timestamp more than a minute in the future is replaced by the current
+	// time.
 	EventID   string    `json:"event_id"`
 	Project   string    `json:"project"`
 	Timestamp Timestamp `json:"timestamp"`
@@ -149,6 +198,7 @@ type Packet struct {
 	// Optional
 	Platform    string                 `json:"platform,omitempty"`
 	Culprit     string                 `json:"culprit,omitempty"`
+	Transaction string                 `json:"transaction,omitempty"`
 	ServerName  string                 `json:"server_name,omitempty"`
 	Release     string                 `json:"release,omitempty"`
 	Environment string                 `json:"environment,omitempty"`
@@ -156,8 +206,21 @@ type Packet struct {
 	Modules     map[string]string      `json:"modules,omitempty"`
 	Fingerprint []string               `json:"fingerprint,omitempty"`
 	Extra       map[string]interface{} `json:"extra,omitempty"`
+	SDK         *SDK                   `json:"sdk,omitempty"`
 
 	Interfaces []Interface `json:"-"`
+
+	// The JSON of a packet sent by CaptureRaw, returned by JSON as it is
+	raw []byte
+
+	// The files sent along with the packet to the envelope endpoint
+	attachments []*Attachment
+}
+
+// An SDK identifies the library that sent an event.
+type SDK struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
 }
 
 // NewPacket constructs a packet with the specified message and interfaces.
@@ -178,18 +241,29 @@ func NewPacket(message string, interfaces ...Interface) *Packet {
 // Init initializes required fields in a packet. It is typically called by
 // Client.Send/Report automatically.
 func (packet *Packet) Init(project string) error {
+	packet.applyOptions()
+
 	if packet.Project == "" {
 		packet.Project = project
 	}
-	if packet.EventID == "" {
+	// A supplied event ID is kept as long as Sentry would accept it
+	if id, ok := normalizeEventID(packet.EventID); ok {
+		packet.EventID = id
+	} else {
 		var err error
 		packet.EventID, err = uuid()
 		if err != nil {
 			return err
 		}
 	}
+	// A supplied timestamp, such as the time of a backfilled event, is kept
+	// unless Sentry would reject it for being in the future
+	now := timeNow().UTC()
 	if time.Time(packet.Timestamp).IsZero() {
-		packet.Timestamp = Timestamp(time.Now())
+		packet.Timestamp = Timestamp(now)
+	} else if t := time.Time(packet.Timestamp); t.After(now.Add(maxTimestampSkew)) {
+		log.Printf("raven: timestamp %s of event %s is in the future, sending it as %s", t.Format(time.RFC3339), packet.EventID, now.Format(time.RFC3339))
+		packet.Timestamp = Timestamp(now)
 	}
 	if packet.Level == "" {
 		packet.Level = ERROR
@@ -203,6 +277,9 @@ func (packet *Packet) Init(project string) error {
 	if packet.Platform == "" {
 		packet.Platform = "go"
 	}
+	if packet.SDK == nil {
+		packet.SDK = &SDK{Name: sdkName, Version: Version}
+	}
 
 	if packet.Culprit == "" {
 		for _, inter := range packet.Interfaces {
@@ -214,16 +291,79 @@ func (packet *Packet) Init(project string) error {
 			}
 		}
 	}
+	if packet.Culprit == "" {
+		// No interface points at the application's code
+		packet.Culprit = packet.Message
+	}
 
 	return nil
 }
 
+// A packetOption is an Interface that sets fields of the packet it is passed
+// with instead of being sent as an interface.
+type packetOption interface {
+	Interface
+	apply(packet *Packet)
+}
+
+// applyOptions applies and removes the packet's options.
+func (packet *Packet) applyOptions() {
+	var interfaces []Interface
+	hasOptions := false
+	for _, inter := range packet.Interfaces {
+		if option, ok := inter.(packetOption); ok {
+			option.apply(packet)
+			hasOptions = true
+		} else {
+			interfaces = append(interfaces, inter)
+		}
+	}
+	// Leave the slice alone when there is nothing to remove, as it may be
+	// shared with the caller
+	if hasOptions {
+		packet.Interfaces = interfaces
+	}
+}
+
 func (packet *Packet) AddTags(tags map[string]string) {
 	for k, v := range tags {
 		packet.Tags = append(packet.Tags, Tag{k, v})
 	}
 }
 
+// addMissingTags adds the tags whose keys the packet does not have yet.
+func (packet *Packet) addMissingTags(tags map[string]string) {
+	for k, v := range tags {
+		if !packet.hasTag(k) {
+			packet.Tags = append(packet.Tags, Tag{k, v})
+		}
+	}
+}
+
+func (packet *Packet) hasTag(key string) bool {
+	for _, tag := range packet.Tags {
+		if tag.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// addMissingExtra adds the extra data whose keys the packet does not have yet.
+func (packet *Packet) addMissingExtra(extra map[string]interface{}) {
+	if len(extra) == 0 {
+		return
+	}
+	if packet.Extra == nil {
+		packet.Extra = make(map[string]interface{}, len(extra))
+	}
+	for k, v := range extra {
+		if _, ok := packet.Extra[k]; !ok {
+			packet.Extra[k] = v
+		}
+	}
+}
+
 func uuid() (string, error) {
 	id := make([]byte, 16)
 	_, err := io.ReadFull(rand.Reader, id)
@@ -237,7 +377,37 @@ func uuid() (string, error) {
 	return hex.EncodeToString(id), nil
 }
 
+// normalizeEventID returns id as 32 lowercase hexadecimal digits, accepting
+// them in either case and with or without the dashes of a UUID, and reports
+// whether id was valid.
+func normalizeEventID(id string) (string, bool) {
+	if len(id) == 36 && id[8] == '-' && id[13] == '-' && id[18] == '-' && id[23] == '-' {
+		id = id[:8] + id[9:13] + id[14:18] + id[19:23] + id[24:]
+	}
+	if len(id) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	return strings.ToLower(id), true
+}
+
+// hasInterface reports whether the packet has an interface of the given class.
+func (packet *Packet) hasInterface(class string) bool {
+	for _, inter := range packet.Interfaces {
+		if inter != nil && inter.Class() == class {
+			return true
+		}
+	}
+	return false
+}
+
 func (packet *Packet) JSON() ([]byte, error) {
+	if packet.raw != nil {
+		return packet.raw, nil
+	}
+
 	packetJSON, err := json.Marshal(packet)
 	if err != nil {
 		return nil, err
@@ -245,7 +415,7 @@ func (packet *Packet) JSON() ([]byte, error) {
 
 	interfaces := make(map[string]Interface, len(packet.Interfaces))
 	for _, inter := range packet.Interfaces {
-		if inter != nil {
+		if !isEmptyInterface(inter) {
 			interfaces[inter.Class()] = inter
 		}
 	}
@@ -306,19 +476,25 @@ func (c *context) interfaces() []Interface {
 }
 
 // The maximum number of packets that will be buffered waiting to be delivered.
-// Packets will be dropped if the buffer is full. Used by NewClient.
+// Packets will be dropped if the buffer is full, and counted by DroppedEvents.
+// Used by New and NewClient when creating the client.
 var MaxQueueBuffer = 100
 
+// The total time allowed for sending a packet by the default transport.
+const defaultTimeout = 15 * time.Second
+
 func newTransport() Transport {
-	t := &HTTPTransport{}
+	t := &HTTPTransport{
+		Client:     &http.Client{Timeout: defaultTimeout},
+		MaxRetries: 2,
+	}
 	rootCAs, err := gocertifi.CACerts()
 	if err != nil {
 		log.Println("raven: failed to load root TLS certificates:", err)
 	} else {
-		t.Client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{RootCAs: rootCAs},
-			},
+		t.Client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs},
 		}
 	}
 	return t
@@ -326,25 +502,37 @@ func newTransport() Transport {
 
 func newClient(tags map[string]string) *Client {
 	client := &Client{
-		Transport: newTransport(),
-		Tags:      tags,
-		context:   &context{},
-		queue:     make(chan *outgoingPacket, MaxQueueBuffer),
+		Transport:      newTransport(),
+		Tags:           tags,
+		context:        &context{},
+		queue:          make(chan *outgoingPacket, MaxQueueBuffer),
+		contextLines:   defaultContextLines,
+		maxBreadcrumbs: defaultMaxBreadcrumbs,
+		sampleRate:     1,
+		serverName:     hostname,
 	}
 	client.SetDSN(os.Getenv("SENTRY_DSN"))
 	return client
 }
 
+// newClientWithDSN returns a client using dsn, or the SENTRY_DSN environment
+// variable if dsn is empty.
+func newClientWithDSN(dsn string, tags map[string]string) (*Client, error) {
+	client := newClient(tags)
+	if dsn == "" {
+		return client, nil
+	}
+	return client, client.SetDSN(dsn)
+}
+
 // New constructs a new Sentry client instance
 func New(dsn string) (*Client, error) {
-	client := newClient(nil)
-	return client, client.SetDSN(dsn)
+	return newClientWithDSN(dsn, nil)
 }
 
 // NewWithTags constructs a new Sentry client instance with default tags.
 func NewWithTags(dsn string, tags map[string]string) (*Client, error) {
-	client := newClient(tags)
-	return client, client.SetDSN(dsn)
+	return newClientWithDSN(dsn, tags)
 }
 
 // NewClient constructs a Sentry client and spawns a background goroutine to
@@ -352,8 +540,7 @@ func NewWithTags(dsn string, tags map[string]string) (*Client, error) {
 //
 // Deprecated: use New and NewWithTags instead
 func NewClient(dsn string, tags map[string]string) (*Client, error) {
-	client := newClient(tags)
-	return client, client.SetDSN(dsn)
+	return newClientWithDSN(dsn, tags)
 }
 
 // Client encapsulates a connection to a Sentry server. It must be initialized
@@ -374,11 +561,81 @@ type Client struct {
 	url                string
 	projectID          string
 	authHeader         string
+	fallbacks          []dsnTarget
+	useEnvelope        bool
 	release            string
 	environment        string
+	logger             string
+	serverName         string
+	defaultTags        map[string]string
+	extra              map[string]interface{}
+	disableContexts    bool
+	modules            map[string]string
+	beforeSend         func(*Packet) *Packet
+	dedupWindow        time.Duration
+	dedupSeen          map[string]time.Time
+	dedupOrder         []dedupEntry
 	includePaths       []string
+	contextLines       int
+	sanitizeFields     []string
 	ignoreErrorsRegexp *regexp.Regexp
 	queue              chan *outgoingPacket
+	closed             bool
+
+	// Request settings used by NewHttp and the handlers
+	captureRequestBody  bool
+	maxRequestBodyBytes int
+	trustProxyHeaders   bool
+	parseCookies        bool
+	preserveQuery       bool
+	routeFunc           func(*http.Request) string
+
+	// Whether the extra data of packets is sent unsanitized
+	disableSanitizeExtra bool
+
+	// Whether messages are sent as the interface preceding logentry
+	legacyMessageInterface bool
+
+	// Whether the environment variables are added to the extra data
+	includeEnviron bool
+
+	// The lowest level of the packets that are sent
+	minLevel Severity
+
+	// The fraction of captured packets that are sent
+	sampleRate      float64
+	alwaysSendFatal bool
+
+	// Maximum lengths of values, which are truncated when packets are sent
+	maxTagValueLength    int
+	maxHeaderValueLength int
+	maxExtraValueLength  int
+
+	// The maximum size of attachments, which are left out beyond it
+	maxAttachmentBytes int
+
+	// The maximum size of the JSON of packets, which are trimmed beyond it
+	maxPacketBytes int
+
+	// The maximum size of the dump of all goroutines added to panics
+	goroutineDumpBytes int
+
+	// Breadcrumbs attached to captured packets
+	breadcrumbs    breadcrumbBuffer
+	maxBreadcrumbs int
+
+	// Counts of packets by outcome
+	statsMu     sync.Mutex
+	sent        uint64
+	failed      uint64
+	rateLimited uint64
+	sampledOut  uint64
+	dropped     uint64
+	suppressed  uint64
+	oversized   uint64
+
+	// The number of tags changed to meet the constraints of Sentry
+	sanitizedTags uint64
 
 	// A WaitGroup to keep track of all currently in-progress captures
 	// This is intended to be used with Client.Wait() to assure that
@@ -392,11 +649,19 @@ type Client struct {
 // Initialize a default *Client instance
 var DefaultClient = newClient(nil)
 
+// SetIgnoreErrors sets regular expressions matching the events to be dropped
+// instead of sent. They are matched against the message of the event, and
+// against the type and value of each of its exceptions. Passing none stops
+// any event from being ignored.
 func (c *Client) SetIgnoreErrors(errs []string) error {
-	joinedRegexp := strings.Join(errs, "|")
-	r, err := regexp.Compile(joinedRegexp)
-	if err != nil {
-		return fmt.Errorf("failed to compile regexp %q for %q: %v", joinedRegexp, errs, err)
+	var r *regexp.Regexp
+	if len(errs) > 0 {
+		joinedRegexp := strings.Join(errs, "|")
+		var err error
+		r, err = regexp.Compile(joinedRegexp)
+		if err != nil {
+			return fmt.Errorf("failed to compile regexp %q for %q: %v", joinedRegexp, errs, err)
+		}
 	}
 
 	c.mu.Lock()
@@ -411,98 +676,332 @@ func (c *Client) shouldExcludeErr(errStr string) bool {
 	return c.ignoreErrorsRegexp != nil && c.ignoreErrorsRegexp.MatchString(errStr)
 }
 
+// shouldExcludePacket reports whether the packet's message, or the type or
+// value of one of its exceptions, matches the errors to ignore.
+func (c *Client) shouldExcludePacket(packet *Packet) bool {
+	c.mu.RLock()
+	r := c.ignoreErrorsRegexp
+	c.mu.RUnlock()
+
+	if r == nil {
+		return false
+	}
+	if r.MatchString(packet.Message) {
+		return true
+	}
+	for _, inter := range packet.Interfaces {
+		var exceptions []*Exception
+		switch inter := inter.(type) {
+		case *Exception:
+			exceptions = []*Exception{inter}
+		case *Exceptions:
+			exceptions = inter.Values
+		}
+		for _, ex := range exceptions {
+			if r.MatchString(ex.Type) || r.MatchString(ex.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func SetIgnoreErrors(errs ...string) error {
 	return DefaultClient.SetIgnoreErrors(errs)
 }
 
 // SetDSN updates a client with a new DSN. It safe to call after and
 // concurrently with calls to Report and Send.
+//
+// An error such as ErrMissingHost or ErrMissingProjectID describes what is
+// wrong with an invalid DSN, which leaves the client unchanged. An empty DSN
+// disables the client, so that its captures do nothing until a DSN is set again.
+// Events already captured are sent to the DSN set when they are delivered.
 func (client *Client) SetDSN(dsn string) error {
-	if dsn == "" {
-		return nil
+	var target dsnTarget
+	if dsn != "" {
+		var err error
+		if target, err = parseDSN(dsn); err != nil {
+			return err
+		}
 	}
 
 	client.mu.Lock()
 	defer client.mu.Unlock()
 
+	client.url = endpointURL(target.url, client.useEnvelope)
+	client.projectID = target.projectID
+	client.authHeader = target.authHeader
+
+	return nil
+}
+
+// A dsnTarget is where the events for a DSN are sent.
+type dsnTarget struct {
+	url        string
+	projectID  string
+	authHeader string
+}
+
+func parseDSN(dsn string) (dsnTarget, error) {
+	var target dsnTarget
+
 	uri, err := url.Parse(dsn)
 	if err != nil {
-		return err
+		return target, fmt.Errorf("raven: invalid dsn: %v", err)
 	}
 
-	if uri.User == nil {
-		return ErrMissingUser
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return target, ErrInvalidScheme
 	}
-	publicKey := uri.User.Username()
-	secretKey, ok := uri.User.Password()
-	if !ok {
-		return ErrMissingPrivateKey
+	if uri.Host == "" {
+		return target, ErrMissingHost
 	}
+	if uri.User == nil || uri.User.Username() == "" {
+		return target, ErrMissingUser
+	}
+	publicKey := uri.User.Username()
+	secretKey, _ := uri.User.Password()
 	uri.User = nil
 
 	if idx := strings.LastIndex(uri.Path, "/"); idx != -1 {
-		client.projectID = uri.Path[idx+1:]
-		uri.Path = uri.Path[:idx+1] + "api/" + client.projectID + "/store/"
+		target.projectID = uri.Path[idx+1:]
+		uri.Path = uri.Path[:idx+1] + "api/" + target.projectID + "/store/"
 	}
-	if client.projectID == "" {
-		return ErrMissingProjectID
+	if target.projectID == "" {
+		return target, ErrMissingProjectID
 	}
 
-	client.url = uri.String()
+	target.url = uri.String()
 
-	client.authHeader = fmt.Sprintf("Sentry sentry_version=4, sentry_key=%s, sentry_secret=%s", publicKey, secretKey)
+	target.authHeader = authHeader(publicKey, secretKey)
 
-	return nil
+	return target, nil
+}
+
+// authHeader returns the X-Sentry-Auth header for the keys of a DSN. Modern
+// DSNs only have a public key, so the secret one is left out when empty.
+func authHeader(publicKey, secretKey string) string {
+	header := fmt.Sprintf("Sentry sentry_version=4, sentry_client=%s, sentry_key=%s", userAgent, publicKey)
+	if secretKey != "" {
+		header += ", sentry_secret=" + secretKey
+	}
+	return header
 }
 
 // Sets the DSN for the default *Client instance
 func SetDSN(dsn string) error { return DefaultClient.SetDSN(dsn) }
 
-// SetRelease sets the "release" tag.
+// SetFallbackDSNs sets DSNs to which events are sent, in order, when sending
+// them to the client's DSN fails, even after any retries by the transport.
+// Each event is sent to the first DSN accepting it only, so it is not
+// duplicated. Passing no DSNs disables the fallback.
+func (client *Client) SetFallbackDSNs(dsns ...string) error {
+	var fallbacks []dsnTarget
+	for _, dsn := range dsns {
+		target, err := parseDSN(dsn)
+		if err != nil {
+			return err
+		}
+		fallbacks = append(fallbacks, target)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for i := range fallbacks {
+		fallbacks[i].url = endpointURL(fallbacks[i].url, client.useEnvelope)
+	}
+	client.fallbacks = fallbacks
+	return nil
+}
+
+// Sets the fallback DSNs for the default *Client instance
+func SetFallbackDSNs(dsns ...string) error { return DefaultClient.SetFallbackDSNs(dsns...) }
+
+// SetRelease sets the release of the application, which is set on every
+// captured packet that does not have one already.
 func (client *Client) SetRelease(release string) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	client.release = release
 }
 
-// SetEnvironment sets the "environment" tag.
+// SetEnvironment sets the environment the application runs in, which is set
+// on every captured packet that does not have one already.
 func (client *Client) SetEnvironment(environment string) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	client.environment = environment
 }
 
-// SetRelease sets the "release" tag on the default *Client
+// SetLogger sets the logger of the packets captured without one, naming the
+// part of the program that reported them such as "db" or "worker" so they can
+// be filtered by it. Packets without a logger are sent with the "root" one,
+// which an empty logger restores.
+func (client *Client) SetLogger(logger string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.logger = logger
+}
+
+// SetLogger sets the default logger on the default *Client
+func SetLogger(logger string) { DefaultClient.SetLogger(logger) }
+
+// SetDefaultTags sets tags added to every captured packet. On a key collision,
+// tags set on the packet itself take precedence, followed by tags passed to
+// Capture, the client's Tags, the tags of its context and these default tags.
+func (client *Client) SetDefaultTags(tags map[string]string) {
+	defaultTags := make(map[string]string, len(tags))
+	for k, v := range tags {
+		defaultTags[k] = v
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.defaultTags = defaultTags
+}
+
+// SetDefaultTags sets the default tags on the default *Client
+func SetDefaultTags(tags map[string]string) { DefaultClient.SetDefaultTags(tags) }
+
+// SetExtra sets extra data added to every captured packet. The packet's own
+// extra data takes precedence on a key collision.
+func (client *Client) SetExtra(extra map[string]interface{}) {
+	clientExtra := make(map[string]interface{}, len(extra))
+	for k, v := range extra {
+		clientExtra[k] = v
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.extra = clientExtra
+}
+
+// SetExtra sets the extra data on the default *Client
+func SetExtra(extra map[string]interface{}) { DefaultClient.SetExtra(extra) }
+
+// SetBeforeSend sets a function called with every captured packet, after
+// its fields are initialized and before it is queued to be sent. The packet
+// it returns, which may be the one it was given after changing it, is sent
+// instead, and returning nil drops the packet. Passing nil removes the
+// function.
+func (client *Client) SetBeforeSend(beforeSend func(*Packet) *Packet) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.beforeSend = beforeSend
+}
+
+// SetBeforeSend sets the function called with the packets captured by the
+// default *Client
+func SetBeforeSend(beforeSend func(*Packet) *Packet) { DefaultClient.SetBeforeSend(beforeSend) }
+
+// SetServerName sets the name of the server, such as a pod or instance name,
+// which is set on every captured packet that does not have one already. It
+// defaults to the hostname, which an empty name reverts to.
+func (client *Client) SetServerName(serverName string) {
+	if serverName == "" {
+		serverName = hostname
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.serverName = serverName
+}
+
+// SetServerName sets the server name on the default *Client
+func SetServerName(serverName string) { DefaultClient.SetServerName(serverName) }
+
+// SetRelease sets the release on the default *Client
 func SetRelease(release string) { DefaultClient.SetRelease(release) }
 
-// SetEnvironment sets the "environment" tag on the default *Client
+// SetEnvironment sets the environment on the default *Client
 func SetEnvironment(environment string) { DefaultClient.SetEnvironment(environment) }
 
 func (client *Client) worker() {
 	for outgoingPacket := range client.queue {
 
 		client.mu.RLock()
-		url, authHeader := client.url, client.authHeader
+		targets := append([]dsnTarget{{client.url, client.projectID, client.authHeader}}, client.fallbacks...)
+		transport := client.Transport
 		client.mu.RUnlock()
 
-		outgoingPacket.ch <- client.Transport.Send(url, authHeader, outgoingPacket.packet)
+		err := deliver(outgoingPacket.ctx, transport, targets, outgoingPacket.packet)
+		client.countDelivery(err)
+		outgoingPacket.ch <- err
 		client.wg.Done()
 	}
 }
 
+// deliver sends the packet to each target in turn until one accepts it,
+// returning the error from the last one otherwise. It gives up with the error
+// of ctx once it is done.
+func deliver(ctx goctx.Context, transport Transport, targets []dsnTarget, packet *Packet) error {
+	var err error
+	for i, target := range targets {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if i > 0 {
+			packet.Project = target.projectID
+		}
+		if t, ok := transport.(ContextTransport); ok {
+			err = t.SendContext(ctx, target.url, target.authHeader, packet)
+		} else {
+			err = transport.Send(target.url, target.authHeader, packet)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// enabled reports whether the client sends events, which requires a DSN. A nil
+// client or one without a DSN can still be used, but all of its captures are
+// no-ops.
+func (client *Client) enabled() bool {
+	if client == nil {
+		return false
+	}
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.url != ""
+}
+
 // Capture asynchronously delivers a packet to the Sentry server. It is a no-op
-// when client is nil. A channel is provided if it is important to check for a
-// send's success.
+// when client is nil or has no DSN. A channel is provided if it is important to
+// check for a send's success.
+//
+// The event ID returned is the packet's EventID, generated by Packet.Init as a
+// random UUID of 32 hexadecimal digits unless it was already set to a valid
+// one, such as a trace ID to correlate the event with. A supplied UUID with
+// dashes or uppercase digits is normalized, and an invalid one is replaced. It
+// is the ID that the event has in Sentry, so it may be logged or shown to users
+// to find the event. It is empty when the packet is not sent, such as when it was
+// ignored or sampled out.
 func (client *Client) Capture(packet *Packet, captureTags map[string]string) (eventID string, ch chan error) {
+	return client.capture(goctx.Background(), packet, captureTags)
+}
+
+// capture is Capture, sending the packet with ctx.
+func (client *Client) capture(ctx goctx.Context, packet *Packet, captureTags map[string]string) (eventID string, ch chan error) {
 	ch = make(chan error, 1)
 
-	if client == nil {
+	if !client.enabled() {
 		// return a chan that always returns nil when the caller receives from it
 		close(ch)
 		return
 	}
 
-	if client.shouldExcludeErr(packet.Message) {
+	// Options such as the Severity may be needed to decide whether to send
+	// the packet
+	packet.applyOptions()
+
+	// Excluded, low level, unsampled and duplicate packets are not sent, so report them
+	// as done right away
+	if client.shouldExcludePacket(packet) || client.belowMinLevel(packet) || !client.sample(packet) || client.isDuplicate(packet) {
+		close(ch)
 		return
 	}
 
@@ -511,18 +1010,54 @@ func (client *Client) Capture(packet *Packet, captureTags map[string]string) (ev
 	// finished being acted upon, whether success or failure
 	client.wg.Add(1)
 
-	// Merge capture tags and client tags
-	packet.AddTags(captureTags)
-	packet.AddTags(client.Tags)
-	packet.AddTags(client.context.tags)
+	// Merge capture tags and client tags, keeping the first value for a key
+	packet.addMissingTags(captureTags)
+	packet.addMissingTags(client.Tags)
+	packet.addMissingTags(client.context.tags)
+
+	client.mu.RLock()
+	packet.addMissingTags(client.defaultTags)
+	packet.addMissingExtra(client.extra)
+	if packet.Modules == nil {
+		packet.Modules = client.packetModules()
+	}
+	includeContexts := !client.disableContexts
+	includeEnviron := client.includeEnviron
+	client.mu.RUnlock()
+
+	if includeEnviron {
+		packet.addMissingExtra(map[string]interface{}{environExtraKey: environ(client.secretFields())})
+	}
+
+	if includeContexts && !packet.hasInterface("contexts") {
+		packet.Interfaces = append(packet.Interfaces, runtimeContexts())
+	}
+
+	if !packet.hasInterface("breadcrumbs") {
+		if breadcrumbs := client.breadcrumbsInterface(); breadcrumbs != nil {
+			packet.Interfaces = append(packet.Interfaces, breadcrumbs)
+		}
+	}
 
 	// Initialize any required packet fields
 	client.mu.RLock()
 	projectID := client.projectID
 	release := client.release
 	environment := client.environment
+	logger := client.logger
+	serverName := client.serverName
+	beforeSend := client.beforeSend
+	limits := client.valueLimits()
+	sanitizeExtra := !client.disableSanitizeExtra
+	legacyMessage := client.legacyMessageInterface
 	client.mu.RUnlock()
 
+	if packet.ServerName == "" {
+		packet.ServerName = serverName
+	}
+	if packet.Logger == "" {
+		packet.Logger = logger
+	}
 	err := packet.Init(projectID)
 	if err != nil {
 		ch <- err
@@ -530,10 +1065,52 @@ func (client *Client) Capture(packet *Packet, captureTags map[string]string) (ev
 		return
 	}
 
-	packet.Release = release
-	packet.Environment = environment
+	if packet.Release == "" {
+		packet.Release = release
+	}
+	if packet.Environment == "" {
+		packet.Environment = environment
+	}
+
+	if beforeSend != nil {
+		if packet = beforeSend(packet); packet == nil {
+			close(ch)
+			client.wg.Done()
+			return
+		}
+	}
+
+	if sanitizeExtra {
+		packet.sanitizeExtra(client.secretFields())
+	}
+	packet.redactUserinfo()
+	if sanitized := packet.sanitizeTags(limits.tag); sanitized > 0 {
+		client.statsMu.Lock()
+		client.sanitizedTags += uint64(sanitized)
+		client.statsMu.Unlock()
+	}
+	packet.truncateValues(limits)
+	packet.dropLargeAttachments(limits.attachment)
+	if legacyMessage {
+		packet.useLegacyMessage()
+	}
+	if !packet.fit(limits.packet) {
+		client.statsMu.Lock()
+		client.oversized++
+		client.statsMu.Unlock()
+		ch <- ErrPacketTooLarge
+		client.wg.Done()
+		return packet.EventID, ch
+	}
+
+	client.enqueue(ctx, packet, ch)
+	return packet.EventID, ch
+}
 
-	outgoingPacket := &outgoingPacket{packet, ch}
+// enqueue queues the packet for the worker to send it with ctx, or reports
+// on ch that it was not. The caller must have added it to client.wg.
+func (client *Client) enqueue(ctx goctx.Context, packet *Packet, ch chan error) {
+	outgoingPacket := &outgoingPacket{packet, ch, ctx}
 
 	// Lazily start background worker until we
 	// do our first write into the queue.
@@ -541,18 +1118,35 @@ func (client *Client) Capture(packet *Packet, captureTags map[string]string) (ev
 		go client.worker()
 	})
 
-	select {
-	case client.queue <- outgoingPacket:
+	// The queue is closed by Close while holding the lock
+	queued := false
+	client.mu.RLock()
+	closed := client.closed
+	if !closed {
+		select {
+		case client.queue <- outgoingPacket:
+			queued = true
+		default:
+		}
+	}
+	client.mu.RUnlock()
+
+	switch {
+	case queued:
+	case closed:
+		ch <- ErrClientClosed
+		client.wg.Done()
 	default:
 		// Send would block, drop the packet
+		client.statsMu.Lock()
+		client.dropped++
+		client.statsMu.Unlock()
 		if client.DropHandler != nil {
 			client.DropHandler(packet)
 		}
 		ch <- ErrPacketDropped
 		client.wg.Done()
 	}
-
-	return packet.EventID, ch
 }
 
 // Capture asynchronously delivers a packet to the Sentry server with the default *Client.
@@ -562,17 +1156,68 @@ func Capture(packet *Packet, captureTags map[string]string) (eventID string, ch
 	return DefaultClient.Capture(packet, captureTags)
 }
 
-// CaptureMessage formats and delivers a string message to the Sentry server.
-func (client *Client) CaptureMessage(message string, tags map[string]string, interfaces ...Interface) string {
-	if client == nil {
-		return ""
+// CaptureAndWait is identical to Capture, except it blocks until the packet
+// was sent and returns the error that sending it failed with, such as the
+// status of the Sentry server or ErrPacketDropped. The error is nil when the
+// packet was sent, or was not meant to be, such as when it was ignored.
+func (client *Client) CaptureAndWait(packet *Packet, captureTags map[string]string) (eventID string, err error) {
+	eventID, ch := client.Capture(packet, captureTags)
+	return eventID, <-ch
+}
+
+// CaptureAndWait is identical to Capture, except it blocks until the packet
+// was sent with the default *Client and returns the error sending it failed
+// with.
+func CaptureAndWait(packet *Packet, captureTags map[string]string) (eventID string, err error) {
+	return DefaultClient.CaptureAndWait(packet, captureTags)
+}
+
+// CaptureRaw sends a JSON event built without raven, such as one forwarded from
+// another process, blocking until it was sent. The payload is sent as it is
+// through the client's transport, with the same authentication, compression,
+// retries and rate limiting as captured packets, but none of the client's
+// settings such as its tags, filters or sample rate are applied to it. The
+// packet given to the transport only has the EventID of the payload, and its
+// JSON method returns the payload.
+//
+// It returns the event_id of the payload, which must be a valid one, or
+// ErrMissingEventID.
+func (client *Client) CaptureRaw(payload []byte) (eventID string, err error) {
+	if !client.enabled() {
+		return "", nil
 	}
 
-	if client.shouldExcludeErr(message) {
+	var event struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", fmt.Errorf("raven: invalid payload: %v", err)
+	}
+	eventID, ok := normalizeEventID(event.EventID)
+	if !ok {
+		return "", ErrMissingEventID
+	}
+
+	ch := make(chan error, 1)
+	client.wg.Add(1)
+	client.enqueue(goctx.Background(), &Packet{EventID: eventID, raw: payload}, ch)
+	return eventID, <-ch
+}
+
+// CaptureRaw sends a JSON event built without raven with the default *Client,
+// blocking until it was sent.
+func CaptureRaw(payload []byte) (eventID string, err error) {
+	return DefaultClient.CaptureRaw(payload)
+}
+
+// CaptureMessage formats and delivers a string message to the Sentry server.
+func (client *Client) CaptureMessage(message string, tags map[string]string, interfaces ...Interface) string {
+	if !client.enabled() || client.shouldExcludeErr(message) {
 		return ""
 	}
 
-	packet := NewPacket(message, append(append(interfaces, client.context.interfaces()...), &Message{message, nil})...)
+	packet := NewPacket(message, append(append(interfaces, client.context.interfaces()...), &Message{Message: message})...)
+	packet.Level = INFO
 	eventID, _ := client.Capture(packet, tags)
 
 	return eventID
@@ -583,17 +1228,40 @@ func CaptureMessage(message string, tags map[string]string, interfaces ...Interf
 	return DefaultClient.CaptureMessage(message, tags, interfaces...)
 }
 
-// CaptureMessageAndWait is identical to CaptureMessage except it blocks and waits for the message to be sent.
-func (client *Client) CaptureMessageAndWait(message string, tags map[string]string, interfaces ...Interface) string {
-	if client == nil {
+// CaptureMessagef formats a message according to a format specifier, like
+// fmt.Sprintf, and delivers it to the Sentry server. The format and the
+// arguments are sent along with the formatted message, so that Sentry groups
+// the messages with the same format together whatever their arguments.
+func (client *Client) CaptureMessagef(format string, args ...interface{}) string {
+	if !client.enabled() {
 		return ""
 	}
 
+	message := fmt.Sprintf(format, args...)
 	if client.shouldExcludeErr(message) {
 		return ""
 	}
 
-	packet := NewPacket(message, append(append(interfaces, client.context.interfaces()...), &Message{message, nil})...)
+	packet := NewPacket(message, append(client.context.interfaces(), &Message{Message: format, Params: args, Formatted: message})...)
+	packet.Level = INFO
+	eventID, _ := client.Capture(packet, nil)
+
+	return eventID
+}
+
+// CaptureMessagef formats and delivers a message to the Sentry server with the default *Client
+func CaptureMessagef(format string, args ...interface{}) string {
+	return DefaultClient.CaptureMessagef(format, args...)
+}
+
+// CaptureMessageAndWait is identical to CaptureMessage except it blocks and waits for the message to be sent.
+func (client *Client) CaptureMessageAndWait(message string, tags map[string]string, interfaces ...Interface) string {
+	if !client.enabled() || client.shouldExcludeErr(message) {
+		return ""
+	}
+
+	packet := NewPacket(message, append(append(interfaces, client.context.interfaces()...), &Message{Message: message})...)
+	packet.Level = INFO
 	eventID, ch := client.Capture(packet, tags)
 	<-ch
 
@@ -608,46 +1276,75 @@ func CaptureMessageAndWait(message string, tags map[string]string, interfaces ..
 // CaptureErrors formats and delivers an error to the Sentry server.
 // Adds a stacktrace to the packet, excluding the call to this method.
 func (client *Client) CaptureError(err error, tags map[string]string, interfaces ...Interface) string {
-	if client == nil {
-		return ""
-	}
-
-	if client.shouldExcludeErr(err.Error()) {
-		return ""
-	}
-
-	packet := NewPacket(err.Error(), append(append(interfaces, client.context.interfaces()...), NewException(err, NewStacktrace(1, 3, client.includePaths)))...)
-	eventID, _ := client.Capture(packet, tags)
-
+	eventID, _ := client.captureError(err, tags, interfaces, 1)
 	return eventID
 }
 
 // CaptureErrors formats and delivers an error to the Sentry server using the default *Client.
 // Adds a stacktrace to the packet, excluding the call to this method.
 func CaptureError(err error, tags map[string]string, interfaces ...Interface) string {
-	return DefaultClient.CaptureError(err, tags, interfaces...)
+	eventID, _ := DefaultClient.captureError(err, tags, interfaces, 1)
+	return eventID
 }
 
 // CaptureErrorAndWait is identical to CaptureError, except it blocks and assures that the event was sent
 func (client *Client) CaptureErrorAndWait(err error, tags map[string]string, interfaces ...Interface) string {
-	if client == nil {
-		return ""
-	}
+	eventID, ch := client.captureError(err, tags, interfaces, 1)
+	<-ch
+	return eventID
+}
 
-	if client.shouldExcludeErr(err.Error()) {
-		return ""
-	}
+// CaptureErrorAndWait is identical to CaptureError, except it blocks and assures that the event was sent
+func CaptureErrorAndWait(err error, tags map[string]string, interfaces ...Interface) string {
+	eventID, ch := DefaultClient.captureError(err, tags, interfaces, 1)
+	<-ch
+	return eventID
+}
 
-	packet := NewPacket(err.Error(), append(append(interfaces, client.context.interfaces()...), NewException(err, NewStacktrace(1, 3, client.includePaths)))...)
-	eventID, ch := client.Capture(packet, tags)
+// CaptureErrorWithSkip is identical to CaptureError, except skip more frames
+// are left out of the stacktrace, for error helpers built on top of raven to
+// report their own callers. A skip of zero reports the call to this method as
+// CaptureError does, and a helper calling it directly passes 1 to report the
+// call to the helper, plus any skip it is given itself for helpers of its own.
+func (client *Client) CaptureErrorWithSkip(err error, skip int, tags map[string]string, interfaces ...Interface) string {
+	eventID, _ := client.captureError(err, tags, interfaces, skip+1)
+	return eventID
+}
+
+// CaptureErrorWithSkip is identical to CaptureError with the default *Client,
+// except skip more frames are left out of the stacktrace.
+func CaptureErrorWithSkip(err error, skip int, tags map[string]string, interfaces ...Interface) string {
+	eventID, _ := DefaultClient.captureError(err, tags, interfaces, skip+1)
+	return eventID
+}
+
+// CaptureErrorAndWaitWithSkip is identical to CaptureErrorWithSkip, except it
+// blocks and assures that the event was sent.
+func (client *Client) CaptureErrorAndWaitWithSkip(err error, skip int, tags map[string]string, interfaces ...Interface) string {
+	eventID, ch := client.captureError(err, tags, interfaces, skip+1)
 	<-ch
+	return eventID
+}
 
+// CaptureErrorAndWaitWithSkip is identical to CaptureErrorWithSkip, except it
+// blocks and assures that the event was sent.
+func CaptureErrorAndWaitWithSkip(err error, skip int, tags map[string]string, interfaces ...Interface) string {
+	eventID, ch := DefaultClient.captureError(err, tags, interfaces, skip+1)
+	<-ch
 	return eventID
 }
 
-// CaptureErrorAndWait is identical to CaptureError, except it blocks and assures that the event was sent
-func CaptureErrorAndWait(err error, tags map[string]string, interfaces ...Interface) string {
-	return DefaultClient.CaptureErrorAndWait(err, tags, interfaces...)
+// captureError captures err with a stacktrace skipping skip frames above its
+// caller, unless err carries its own.
+func (client *Client) captureError(err error, tags map[string]string, interfaces []Interface, skip int) (string, chan error) {
+	if !client.enabled() || client.shouldExcludeErr(err.Error()) {
+		ch := make(chan error)
+		close(ch)
+		return "", ch
+	}
+
+	packet := NewPacket(err.Error(), append(append(interfaces, client.context.interfaces()...), NewExceptions(err, client.errorStacktrace(err, skip+1)))...)
+	return client.Capture(packet, tags)
 }
 
 // CapturePanic calls f and then recovers and reports a panic to the Sentry server if it occurs.
@@ -658,25 +1355,13 @@ func (client *Client) CapturePanic(f func(), tags map[string]string, interfaces
 	// *Packet just to be thrown away, this should not be the normal case. Could be refactored to
 	// be completely noop though if we cared.
 	defer func() {
-		var packet *Packet
 		err = recover()
-		switch rval := err.(type) {
-		case nil:
+		if err == nil {
 			return
-		case error:
-			if client.shouldExcludeErr(rval.Error()) {
-				return
-			}
-			packet = NewPacket(rval.Error(), append(append(interfaces, client.context.interfaces()...), NewException(rval, NewStacktrace(2, 3, client.includePaths)))...)
-		default:
-			rvalStr := fmt.Sprint(rval)
-			if client.shouldExcludeErr(rvalStr) {
-				return
-			}
-			packet = NewPacket(rvalStr, append(append(interfaces, client.context.interfaces()...), NewException(errors.New(rvalStr), NewStacktrace(2, 3, client.includePaths)))...)
 		}
-
-		errorID, _ = client.Capture(packet, tags)
+		if packet := client.panicPacket(err, interfaces); packet != nil {
+			errorID, _ = client.Capture(packet, tags)
+		}
 	}()
 
 	f()
@@ -696,27 +1381,15 @@ func (client *Client) CapturePanicAndWait(f func(), tags map[string]string, inte
 	// *Packet just to be thrown away, this should not be the normal case. Could be refactored to
 	// be completely noop though if we cared.
 	defer func() {
-		var packet *Packet
 		err = recover()
-		switch rval := err.(type) {
-		case nil:
+		if err == nil {
 			return
-		case error:
-			if client.shouldExcludeErr(rval.Error()) {
-				return
-			}
-			packet = NewPacket(rval.Error(), append(append(interfaces, client.context.interfaces()...), NewException(rval, NewStacktrace(2, 3, client.includePaths)))...)
-		default:
-			rvalStr := fmt.Sprint(rval)
-			if client.shouldExcludeErr(rvalStr) {
-				return
-			}
-			packet = NewPacket(rvalStr, append(append(interfaces, client.context.interfaces()...), NewException(errors.New(rvalStr), NewStacktrace(2, 3, client.includePaths)))...)
 		}
-
-		var ch chan error
-		errorID, ch = client.Capture(packet, tags)
-		<-ch
+		if packet := client.panicPacket(err, interfaces); packet != nil {
+			var ch chan error
+			errorID, ch = client.Capture(packet, tags)
+			<-ch
+		}
 	}()
 
 	f()
@@ -728,30 +1401,88 @@ func CapturePanicAndWait(f func(), tags map[string]string, interfaces ...Interfa
 	return DefaultClient.CapturePanicAndWait(f, tags, interfaces...)
 }
 
+// CapturePanicAndRepanic calls f and, if it panics, reports the panic to the
+// Sentry server and waits for it to be sent before letting the panic continue.
+// Panics in goroutines started outside of an HTTP handler, such as background
+// workers, can be reported before they crash the process with:
+//
+//	go client.CapturePanicAndRepanic(func() {
+//		// ...
+//	}, nil)
+//
+// Use CapturePanic instead to recover from the panic.
+func (client *Client) CapturePanicAndRepanic(f func(), tags map[string]string, interfaces ...Interface) {
+	defer func() {
+		if rval := recover(); rval != nil {
+			client.ReportPanicAndWait(rval, tags, interfaces...)
+		}
+	}()
+
+	f()
+}
+
+// CapturePanicAndRepanic calls f and, if it panics, reports the panic to the
+// Sentry server with the default *Client before letting the panic continue.
+func CapturePanicAndRepanic(f func(), tags map[string]string, interfaces ...Interface) {
+	DefaultClient.CapturePanicAndRepanic(f, tags, interfaces...)
+}
+
+// errorStacktrace returns the stacktrace recorded by err if it has one, and
+// otherwise the current stacktrace, skipping skip frames.
+func (client *Client) errorStacktrace(err error, skip int) *Stacktrace {
+	if stacktrace := NewStacktraceFromError(err, client.ContextLines(), client.IncludePaths()); stacktrace != nil {
+		return stacktrace
+	}
+	return NewStacktrace(skip+1, client.ContextLines(), client.IncludePaths())
+}
+
+// panicError returns a recovered panic value as an error, keeping its
+// concrete type when it already implements error.
+func panicError(rval interface{}) error {
+	if err, ok := rval.(error); ok {
+		return err
+	}
+	return errors.New(fmt.Sprint(rval))
+}
+
+// panicPacket builds the packet reported for a recovered panic value, or
+// returns nil if the error should be ignored or the client is disabled.
+func (client *Client) panicPacket(rval interface{}, interfaces []Interface) *Packet {
+	if !client.enabled() {
+		return nil
+	}
+	err := panicError(rval)
+	if client.shouldExcludeErr(err.Error()) {
+		return nil
+	}
+	packet := NewPacket(err.Error(), append(append(interfaces, client.context.interfaces()...), NewException(err, NewPanicStacktrace(client.ContextLines(), client.IncludePaths())))...)
+	packet.Level = FATAL
+	if dump := client.goroutineDump(); dump != "" {
+		packet.Extra[goroutinesExtraKey] = dump
+	}
+	return packet
+}
+
+// NewPanicPacket builds the packet CapturePanic reports for the recovered
+// panic value rval, or returns nil if the client is disabled or ignores the
+// panic. It must be called while the panic is unwinding, from the deferred
+// function recovering it, so that its stacktrace starts where f panicked.
+func (client *Client) NewPanicPacket(rval interface{}, interfaces ...Interface) *Packet {
+	return client.panicPacket(rval, interfaces)
+}
+
 // ReportPanic reports a panic to the Sentry server if it occurs and allows that panic to continue.
 func (client *Client) ReportPanic(err interface{}, tags map[string]string, interfaces ...Interface) {
 	// Note: This doesn't need to check for client, because we still want to go through the defer/recover path
 	// Down the line, Capture will be noop'd, so while this does a _tiny_ bit of overhead constructing the
 	// *Packet just to be thrown away, this should not be the normal case. Could be refactored to
 	// be completely noop though if we cared.
-	var packet *Packet
-	switch rval := err.(type) {
-	case nil:
+	if err == nil {
 		return
-	case error:
-		if client.shouldExcludeErr(rval.Error()) {
-			return
-		}
-		packet = NewPacket(rval.Error(), append(append(interfaces, client.context.interfaces()...), NewException(rval, NewStacktrace(2, 3, client.includePaths)))...)
-	default:
-		rvalStr := fmt.Sprint(rval)
-		if client.shouldExcludeErr(rvalStr) {
-			return
-		}
-		packet = NewPacket(rvalStr, append(append(interfaces, client.context.interfaces()...), NewException(errors.New(rvalStr), NewStacktrace(2, 3, client.includePaths)))...)
 	}
-
-	client.Capture(packet, tags)
+	if packet := client.panicPacket(err, interfaces); packet != nil {
+		client.Capture(packet, tags)
+	}
 	// send the panic up the stack
 	panic(err)
 }
@@ -771,26 +1502,14 @@ func (client *Client) ReportPanicAndWait(err interface{}, tags map[string]string
 	// Down the line, Capture will be noop'd, so while this does a _tiny_ bit of overhead constructing the
 	// *Packet just to be thrown away, this should not be the normal case. Could be refactored to
 	// be completely noop though if we cared.
-
-	var packet *Packet
-	switch rval := err.(type) {
-	case nil:
+	if err == nil {
 		return
-	case error:
-		if client.shouldExcludeErr(rval.Error()) {
-			return
-		}
-		packet = NewPacket(rval.Error(), append(append(interfaces, client.context.interfaces()...), NewException(rval, NewStacktrace(2, 3, client.includePaths)))...)
-	default:
-		rvalStr := fmt.Sprint(rval)
-		if client.shouldExcludeErr(rvalStr) {
-			return
-		}
-		packet = NewPacket(rvalStr, append(append(interfaces, client.context.interfaces()...), NewException(errors.New(rvalStr), NewStacktrace(2, 3, client.includePaths)))...)
 	}
-	_, ch := client.Capture(packet, tags)
-	// block to make sure the report is sent
-	<-ch
+	if packet := client.panicPacket(err, interfaces); packet != nil {
+		_, ch := client.Capture(packet, tags)
+		// block to make sure the report is sent
+		<-ch
+	}
 	// send the panic up the stack
 	panic(err)
 }
@@ -804,13 +1523,83 @@ func ReportPanicAndWait(tags map[string]string, interfaces ...Interface) {
 	DefaultClient.ReportPanicAndWait(err, tags, interfaces...)
 }
 
+// Close waits for the events already captured to be sent to the Sentry
+// server and stops the client's background worker. Events captured after
+// Close are not sent, and their channel receives ErrClientClosed.
 func (client *Client) Close() {
-	close(client.queue)
+	client.mu.Lock()
+	if !client.closed {
+		client.closed = true
+		close(client.queue)
+	}
+	client.mu.Unlock()
+
+	client.Wait()
 }
 
 func Close() { DefaultClient.Close() }
 
+// RateLimited reports whether the Sentry server asked for no events to be sent
+// to it for now. Only transports with a RateLimited(url string) bool method,
+// such as HTTPTransport, are ever rate limited.
+func (client *Client) RateLimited() bool {
+	client.mu.RLock()
+	url, transport := client.url, client.Transport
+	client.mu.RUnlock()
+
+	if limiter, ok := transport.(interface {
+		RateLimited(url string) bool
+	}); ok {
+		return limiter.RateLimited(url)
+	}
+	return false
+}
+
+func RateLimited() bool { return DefaultClient.RateLimited() }
+
+// SetHTTPClient sets the HTTP client used to send events to Sentry, for
+// example to configure TLS, proxies or timeouts. It replaces the client's
+// Transport by an HTTPTransport keeping the compression and retry settings of
+// the current one, if it is an HTTPTransport.
+func (client *Client) SetHTTPClient(httpClient *http.Client) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	current, _ := client.Transport.(*HTTPTransport)
+	client.Transport = current.withClient(httpClient)
+}
+
+func SetHTTPClient(httpClient *http.Client) { DefaultClient.SetHTTPClient(httpClient) }
+
+// SetTimeout sets the total time allowed for each attempt at sending an event
+// to Sentry, including connecting and reading the response. The default
+// transport allows 15 seconds. It has no effect unless the client's Transport
+// is an HTTPTransport.
+func (client *Client) SetTimeout(timeout time.Duration) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	current, ok := client.Transport.(*HTTPTransport)
+	if !ok {
+		return
+	}
+	// The current HTTP client may be in use, so change a copy
+	httpClient := &http.Client{}
+	if current.Client != nil {
+		*httpClient = *current.Client
+	}
+	httpClient.Timeout = timeout
+	client.Transport = current.withClient(httpClient)
+}
+
+func SetTimeout(timeout time.Duration) { DefaultClient.SetTimeout(timeout) }
+
 // Wait blocks and waits for all events to finish being sent to Sentry server
+//
+// Every event captured before Wait is called has then been sent, or has
+// failed to be or been dropped, so tests may check what was reported without
+// sleeping. Unlike Close, Wait leaves the client usable, and unlike Flush it
+// waits for as long as sending the events takes.
 func (client *Client) Wait() {
 	client.wg.Wait()
 }
@@ -818,6 +1607,39 @@ func (client *Client) Wait() {
 // Wait blocks and waits for all events to finish being sent to Sentry server
 func Wait() { DefaultClient.Wait() }
 
+// Flush blocks until all events have finished being sent to the Sentry
+// server, like Wait, or until the timeout elapses. It reports whether every
+// event was sent in time.
+func (client *Client) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		client.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Flush blocks until all events have finished being sent to the Sentry
+// server, or until the timeout elapses
+func Flush(timeout time.Duration) bool { return DefaultClient.Flush(timeout) }
+
+// DroppedEvents returns the number of events the client dropped because its
+// queue of MaxQueueBuffer events waiting to be sent was full.
+func (client *Client) DroppedEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.dropped
+}
+
+func DroppedEvents() uint64 { return DefaultClient.DroppedEvents() }
+
 func (client *Client) URL() string {
 	client.mu.RLock()
 	defer client.mu.RUnlock()
@@ -856,6 +1678,9 @@ func (client *Client) IncludePaths() []string {
 
 func SetIncludePaths(p []string) { DefaultClient.SetIncludePaths(p) }
 
+// SetIncludePaths sets the import path prefixes of the packages that make up
+// the application. Stack frames from packages matching one of them are marked
+// in_app, and frames from any other package (apart from main) are not.
 func (client *Client) SetIncludePaths(p []string) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -863,6 +1688,107 @@ func (client *Client) SetIncludePaths(p []string) {
 	client.includePaths = p
 }
 
+func SetSampleRate(rate float64) error { return DefaultClient.SetSampleRate(rate) }
+
+// SetSampleRate sets the fraction of captured packets that are sent to
+// Sentry, chosen at random for each packet. 0 drops every packet and 1, the
+// default, sends every one.
+func (client *Client) SetSampleRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return ErrInvalidSampleRate
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.sampleRate = rate
+	return nil
+}
+
+func SetAlwaysSendFatal(always bool) { DefaultClient.SetAlwaysSendFatal(always) }
+
+// SetAlwaysSendFatal sets whether packets with the FATAL level are sent
+// regardless of the sample rate.
+func (client *Client) SetAlwaysSendFatal(always bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.alwaysSendFatal = always
+}
+
+func SetMinLevel(level Severity) { DefaultClient.SetMinLevel(level) }
+
+// SetMinLevel sets the lowest level of the packets that are sent, so that
+// captures of a lower level are dropped, such as INFO and DEBUG messages when
+// it is WARNING. Packets without a level are ERROR ones, and packets of an
+// unknown level are always sent. All packets are sent when the level is empty,
+// which it is by default.
+func (client *Client) SetMinLevel(level Severity) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.minLevel = level
+}
+
+// belowMinLevel reports whether the packet's level is lower than the client's
+// minimum level.
+func (client *Client) belowMinLevel(packet *Packet) bool {
+	client.mu.RLock()
+	minLevel := client.minLevel
+	client.mu.RUnlock()
+
+	level := packet.Level
+	if level == "" {
+		level = ERROR
+	}
+	rank := severityRank(level)
+	return rank > 0 && rank < severityRank(minLevel)
+}
+
+// sample reports whether the packet should be sent according to the sample
+// rate, counting the packets that are not.
+func (client *Client) sample(packet *Packet) bool {
+	client.mu.RLock()
+	rate, alwaysSendFatal := client.sampleRate, client.alwaysSendFatal
+	client.mu.RUnlock()
+
+	if rate >= 1 || (alwaysSendFatal && packet.Level == FATAL) || mathrand.Float64() < rate {
+		return true
+	}
+
+	client.statsMu.Lock()
+	client.sampledOut++
+	client.statsMu.Unlock()
+	return false
+}
+
+// The number of source lines included before and after each stack frame when
+// SetContextLines has not been called.
+const defaultContextLines = 3
+
+func ContextLines() int { return DefaultClient.ContextLines() }
+
+// ContextLines returns the number of source lines included before and after
+// each frame of the stacktraces this client captures.
+func (client *Client) ContextLines() int {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	return client.contextLines
+}
+
+func SetContextLines(n int) { DefaultClient.SetContextLines(n) }
+
+// SetContextLines sets the number of source lines included before and after
+// each frame of the stacktraces this client captures. Zero includes no source
+// context, and -1 includes only the line of the frame itself.
+func (client *Client) SetContextLines(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.contextLines = n
+}
+
 func (c *Client) SetUserContext(u *User)             { c.context.SetUser(u) }
 func (c *Client) SetHttpContext(h *Http)             { c.context.SetHttp(h) }
 func (c *Client) SetTagsContext(t map[string]string) { c.context.SetTags(t) }
@@ -877,58 +1803,186 @@ func ClearContext()                      { DefaultClient.ClearContext() }
 // HTTP API.
 type HTTPTransport struct {
 	*http.Client
+
+	// Packets whose JSON is larger than this many bytes are sent gzip
+	// compressed, as compressing smaller ones is not worth the overhead. Zero
+	// uses a threshold of 1KB, and a negative value disables compression.
+	CompressionThreshold int
+
+	// The number of times a packet is resent after a connection error, a
+	// timeout or a 5xx response. The delay before each retry starts at
+	// RetryBackoff, 100ms when zero, and doubles for each one, with random
+	// jitter.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// After this many consecutive sends to a URL failed with a connection
+	// error, a timeout or a 5xx response, after any retries, the circuit for
+	// the URL opens: packets sent to it are dropped with ErrCircuitOpen for
+	// CircuitCooldown. A single packet is then sent to probe the server, and
+	// the circuit closes again if it gets through. Zero uses a threshold of 5
+	// and a cooldown of 30s, and a negative CircuitThreshold disables the
+	// circuit breaker.
+	CircuitThreshold int
+	CircuitCooldown  time.Duration
+
+	// The times until which Sentry asked for no events to be sent, and the
+	// circuits, by URL
+	mu           sync.Mutex
+	blockedUntil map[string]time.Time
+	circuits     map[string]*circuit
 }
 
+// The CompressionThreshold and RetryBackoff used when they are zero.
+const (
+	defaultCompressionThreshold = 1000
+	defaultRetryBackoff         = 100 * time.Millisecond
+)
+
 func (t *HTTPTransport) Send(url, authHeader string, packet *Packet) error {
+	return t.SendContext(goctx.Background(), url, authHeader, packet)
+}
+
+// SendContext is identical to Send, except the request is made with ctx, so
+// that it is aborted along with any retry once ctx is done.
+func (t *HTTPTransport) SendContext(ctx goctx.Context, url, authHeader string, packet *Packet) error {
 	if url == "" {
 		return nil
 	}
+	if t.RateLimited(url) {
+		return ErrRateLimited
+	}
 
-	body, contentType, err := serializedPacket(packet)
+	body, contentEncoding, err := t.serializedPacket(packet, isEnvelopeURL(url))
 	if err != nil {
 		return fmt.Errorf("error serializing packet: %v", err)
 	}
-	req, err := http.NewRequest("POST", url, body)
+	if !t.allowSend(url) {
+		return ErrCircuitOpen
+	}
+
+	backoff := t.RetryBackoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	for retries := 0; ; retries++ {
+		retry, err := t.post(ctx, url, authHeader, body, contentEncoding)
+		if err == nil || !retry || retries >= t.MaxRetries {
+			t.recordSend(url, retry, ctx.Err() != nil)
+			return err
+		}
+		// Wait for a random time between half the backoff and the backoff
+		delay := backoff << uint(retries)
+		select {
+		case <-time.After(delay/2 + time.Duration(mathrand.Int63n(int64(delay/2)+1))):
+		case <-ctx.Done():
+			t.recordSend(url, false, true)
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a serialized packet, reporting whether it may succeed if retried
+// when it fails.
+func (t *HTTPTransport) post(ctx goctx.Context, url, authHeader string, body []byte, contentEncoding string) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("can't create new request: %v", err)
+		return false, fmt.Errorf("can't create new request: %v", err)
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("X-Sentry-Auth", authHeader)
 	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Content-Type", contentType)
+	if isEnvelopeURL(url) {
+		req.Header.Set("Content-Type", envelopeContentType)
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 	res, err := t.Do(req)
 	if err != nil {
-		return err
+		// Connection errors and timeouts
+		return true, err
 	}
 	io.Copy(ioutil.Discard, res.Body)
 	res.Body.Close()
+	if until, ok := rateLimitedUntil(res, timeNow()); ok {
+		t.mu.Lock()
+		if t.blockedUntil == nil {
+			t.blockedUntil = make(map[string]time.Time)
+		}
+		t.blockedUntil[url] = until
+		t.mu.Unlock()
+	}
+	if res.StatusCode == 429 {
+		return false, ErrRateLimited
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("raven: got http status %d", res.StatusCode)
+		return res.StatusCode >= 500, fmt.Errorf("raven: got http status %d", res.StatusCode)
 	}
-	return nil
+	return false, nil
+}
+
+// withClient returns a transport using httpClient, with the same compression
+// and retry settings as t, which may be nil.
+func (t *HTTPTransport) withClient(httpClient *http.Client) *HTTPTransport {
+	transport := &HTTPTransport{Client: httpClient}
+	if t != nil {
+		transport.CompressionThreshold = t.CompressionThreshold
+		transport.MaxRetries = t.MaxRetries
+		transport.RetryBackoff = t.RetryBackoff
+		transport.CircuitThreshold = t.CircuitThreshold
+		transport.CircuitCooldown = t.CircuitCooldown
+	}
+	return transport
 }
 
-func serializedPacket(packet *Packet) (io.Reader, string, error) {
+// RateLimited reports whether Sentry asked for no events to be sent to url
+// for now. Events sent meanwhile are dropped with ErrRateLimited.
+func (t *HTTPTransport) RateLimited(url string) bool {
+	return !t.RateLimitedUntil(url).IsZero()
+}
+
+// RateLimitedUntil returns the time until which the Sentry server at url asked
+// for no events to be sent, or the zero time if it is not rate limiting them.
+func (t *HTTPTransport) RateLimitedUntil(url string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := t.blockedUntil[url]; timeNow().Before(until) {
+		return until
+	}
+	return time.Time{}
+}
+
+// serializedPacket returns the packet's JSON, in an envelope if inEnvelope is
+// set, compressed if it is larger than the transport's CompressionThreshold,
+// and the content encoding used.
+func (t *HTTPTransport) serializedPacket(packet *Packet, inEnvelope bool) ([]byte, string, error) {
 	packetJSON, err := packet.JSON()
 	if err != nil {
 		return nil, "", fmt.Errorf("error marshaling packet %+v to JSON: %v", packet, err)
 	}
+	if inEnvelope {
+		if packetJSON, err = envelope(packet, packetJSON); err != nil {
+			return nil, "", fmt.Errorf("error building envelope: %v", err)
+		}
+	}
 
-	// Only deflate/base64 the packet if it is bigger than 1KB, as there is
-	// overhead.
-	if len(packetJSON) > 1000 {
+	threshold := t.CompressionThreshold
+	if threshold == 0 {
+		threshold = defaultCompressionThreshold
+	}
+	if threshold > 0 && len(packetJSON) > threshold {
 		buf := &bytes.Buffer{}
-		b64 := base64.NewEncoder(base64.StdEncoding, buf)
-		deflate, _ := zlib.NewWriterLevel(b64, zlib.BestCompression)
-		deflate.Write(packetJSON)
-		deflate.Close()
-		b64.Close()
-		return buf, "application/octet-stream", nil
+		gz := gzip.NewWriter(buf)
+		gz.Write(packetJSON)
+		gz.Close()
+		return buf.Bytes(), "gzip", nil
 	}
-	return bytes.NewReader(packetJSON), "application/json", nil
+	return packetJSON, "", nil
 }
 
-var hostname string
-
-func init() {
-	hostname, _ = os.Hostname()
-}
+// Initialized before DefaultClient, whose server name defaults to it
+var hostname, _ = os.Hostname()
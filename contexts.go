@@ -0,0 +1,64 @@
+package raven
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Contexts describe the environment an event happened in, keyed by the type
+// of context such as "runtime", "os" or "device".
+//
+// https://docs.sentry.io/clientdev/interfaces/contexts/
+type Contexts map[string]interface{}
+
+func (c Contexts) Class() string { return "contexts" }
+
+var (
+	kernelVersionOnce sync.Once
+	kernelVersion     string
+)
+
+// osKernelVersion returns the version of the kernel, when it can be found.
+func osKernelVersion() string {
+	kernelVersionOnce.Do(func() {
+		if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+			kernelVersion = strings.TrimSpace(string(release))
+		}
+	})
+	return kernelVersion
+}
+
+// runtimeContexts returns the contexts of the Go runtime, operating system and
+// device the program runs on.
+func runtimeContexts() Contexts {
+	os := map[string]interface{}{"name": runtime.GOOS}
+	if version := osKernelVersion(); version != "" {
+		os["kernel_version"] = version
+	}
+	return Contexts{
+		"runtime": map[string]interface{}{
+			"name":       "go",
+			"version":    runtime.Version(),
+			"gomaxprocs": runtime.GOMAXPROCS(0),
+		},
+		"os": os,
+		"device": map[string]interface{}{
+			"arch":            runtime.GOARCH,
+			"processor_count": runtime.NumCPU(),
+		},
+	}
+}
+
+func SetIncludeContexts(include bool) { DefaultClient.SetIncludeContexts(include) }
+
+// SetIncludeContexts sets whether the contexts of the Go runtime, operating
+// system and device are added to every captured packet, which they are by
+// default.
+func (client *Client) SetIncludeContexts(include bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.disableContexts = !include
+}
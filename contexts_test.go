@@ -0,0 +1,52 @@
+package raven
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+func TestCaptureContexts(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.Capture(NewPacket("boom"), nil)
+	client.SetIncludeContexts(false)
+	client.Capture(NewPacket("boom"), nil)
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets: got %d, want 2", len(packets))
+	}
+	j, err := packets[0].JSON()
+	if err != nil {
+		t.Fatalf("JSON marshalling should not fail: %v", err)
+	}
+	var actual struct {
+		Contexts struct {
+			Runtime struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"runtime"`
+			OS struct {
+				Name string `json:"name"`
+			} `json:"os"`
+			Device struct {
+				Arch           string `json:"arch"`
+				ProcessorCount int    `json:"processor_count"`
+			} `json:"device"`
+		} `json:"contexts"`
+	}
+	if err := json.Unmarshal(j, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Contexts.Runtime.Version != runtime.Version() {
+		t.Errorf("incorrect contexts.runtime.version: got %q, want %q", actual.Contexts.Runtime.Version, runtime.Version())
+	}
+	if actual.Contexts.OS.Name != runtime.GOOS || actual.Contexts.Device.Arch != runtime.GOARCH || actual.Contexts.Device.ProcessorCount != runtime.NumCPU() {
+		t.Errorf("incorrect contexts: got %+v", actual.Contexts)
+	}
+
+	if packets[1].hasInterface("contexts") {
+		t.Error("contexts were added after SetIncludeContexts(false)")
+	}
+}
@@ -0,0 +1,120 @@
+package raven
+
+import (
+	goctx "context"
+)
+
+type contextKey int
+
+const (
+	clientKey contextKey = iota
+	scopeKey
+)
+
+// WithClient returns a copy of ctx carrying client, which is used by the
+// functions capturing events with ctx instead of DefaultClient.
+func WithClient(ctx goctx.Context, client *Client) goctx.Context {
+	return goctx.WithValue(ctx, clientKey, client)
+}
+
+// FromContext returns the client carried by ctx, or DefaultClient if there is
+// none.
+func FromContext(ctx goctx.Context) *Client {
+	if client, ok := ctx.Value(clientKey).(*Client); ok {
+		return client
+	}
+	return DefaultClient
+}
+
+// WithTags returns a copy of ctx adding tags to the events captured with it,
+// along with the tags already carried by ctx. The tags passed when capturing
+// an event take precedence over them.
+func WithTags(ctx goctx.Context, tags map[string]string) goctx.Context {
+	scope := scopeFromContext(ctx)
+	scope.tags = mergeTags(scope.tags, tags)
+	return goctx.WithValue(ctx, scopeKey, scope)
+}
+
+// WithUser returns a copy of ctx adding the user to the events captured with
+// it.
+func WithUser(ctx goctx.Context, user *User) goctx.Context {
+	scope := scopeFromContext(ctx)
+	scope.SetUser(user)
+	return goctx.WithValue(ctx, scopeKey, scope)
+}
+
+// WithHttp returns a copy of ctx adding the request to the events captured
+// with it.
+func WithHttp(ctx goctx.Context, h *Http) goctx.Context {
+	scope := scopeFromContext(ctx)
+	scope.SetHttp(h)
+	return goctx.WithValue(ctx, scopeKey, scope)
+}
+
+// scopeFromContext returns a copy of the user, request and tags carried by
+// ctx. The tags are shared with ctx so they must not be modified in place.
+func scopeFromContext(ctx goctx.Context) *context {
+	if scope, ok := ctx.Value(scopeKey).(*context); ok {
+		copied := *scope
+		return &copied
+	}
+	return &context{}
+}
+
+// mergeTags returns a new map of the base tags overridden by tags.
+func mergeTags(base, tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(tags))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// CaptureErrorWithContext formats and delivers an error to the Sentry server
+// using the client carried by ctx, adding the user, request and tags carried
+// by ctx to the event. Adds a stacktrace to the packet, excluding the call to
+// this function.
+func CaptureErrorWithContext(ctx goctx.Context, err error, tags map[string]string, interfaces ...Interface) string {
+	scope := scopeFromContext(ctx)
+	eventID, _ := FromContext(ctx).captureError(err, mergeTags(scope.tags, tags), append(scope.interfaces(), interfaces...), 1)
+	return eventID
+}
+
+// CaptureMessageWithContext formats and delivers a string message to the
+// Sentry server using the client carried by ctx, adding the user, request and
+// tags carried by ctx to the event.
+func CaptureMessageWithContext(ctx goctx.Context, message string, tags map[string]string, interfaces ...Interface) string {
+	scope := scopeFromContext(ctx)
+	return FromContext(ctx).CaptureMessage(message, mergeTags(scope.tags, tags), append(scope.interfaces(), interfaces...)...)
+}
+
+// CaptureWithContext is identical to CaptureAndWait, except the packet is
+// delivered using the client carried by ctx, with the user, request and tags
+// carried by ctx, and sending it is aborted once ctx is done. This keeps the
+// capture of an event about a request from outliving the request.
+func CaptureWithContext(ctx goctx.Context, packet *Packet, captureTags map[string]string) (eventID string, err error) {
+	return FromContext(ctx).CaptureWithContext(ctx, packet, captureTags)
+}
+
+// CaptureWithContext is identical to CaptureAndWait, except the user, request
+// and tags carried by ctx are added to the packet, and it returns the error of
+// ctx as soon as ctx is done, aborting the send.
+func (client *Client) CaptureWithContext(ctx goctx.Context, packet *Packet, captureTags map[string]string) (eventID string, err error) {
+	scope := scopeFromContext(ctx)
+	for _, inter := range scope.interfaces() {
+		if !packet.hasInterface(inter.Class()) {
+			packet.Interfaces = append(packet.Interfaces, inter)
+		}
+	}
+
+	eventID, ch := client.capture(ctx, packet, mergeTags(scope.tags, captureTags))
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return eventID, err
+}
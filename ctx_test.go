@@ -0,0 +1,134 @@
+package raven
+
+import (
+	goctx "context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFromContext(t *testing.T) {
+	if client := FromContext(goctx.Background()); client != DefaultClient {
+		t.Error("context without a client did not return DefaultClient")
+	}
+	client, _ := newRecordingClient(t)
+	if FromContext(WithClient(goctx.Background(), client)) != client {
+		t.Error("incorrect client from context")
+	}
+}
+
+func TestCaptureWithContext(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	ctx := WithClient(goctx.Background(), client)
+	ctx = WithTags(ctx, map[string]string{"request": "1", "route": "/orders"})
+	ctx = WithUser(ctx, &User{ID: "42"})
+	parent := ctx
+	ctx = WithTags(ctx, map[string]string{"route": "/orders/:id"})
+
+	// Events captured by goroutines spawned for the request are enriched too
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		CaptureErrorWithContext(ctx, errors.New("boom"), map[string]string{"request": "2"})
+	}()
+	go func() {
+		defer wg.Done()
+		CaptureMessageWithContext(parent, "hello", nil)
+	}()
+	wg.Wait()
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets: got %d, want 2", len(packets))
+	}
+	for _, packet := range packets {
+		expected := map[string]string{"request": "1", "route": "/orders"}
+		if packet.Message == "boom" {
+			expected = map[string]string{"request": "2", "route": "/orders/:id"}
+		}
+		for key, value := range expected {
+			if actual := tagValue(packet.Tags, key); actual != value {
+				t.Errorf("incorrect %s tag for %q: got %q, want %q", key, packet.Message, actual, value)
+			}
+		}
+		var user *User
+		for _, inter := range packet.Interfaces {
+			if u, ok := inter.(*User); ok {
+				user = u
+			}
+		}
+		if user == nil || user.ID != "42" {
+			t.Errorf("incorrect user for %q: got %#v", packet.Message, user)
+		}
+	}
+}
+
+func TestCaptureWithContextCanceled(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the client hanging up once the body is read
+		ioutil.ReadAll(r.Body)
+		close(started)
+		select {
+		case <-r.Context().Done():
+			aborted <- true
+		case <-time.After(5 * time.Second):
+			aborted <- false
+		}
+	}))
+	defer server.Close()
+
+	client, _ := newRecordingClient(t)
+	client.Transport = &HTTPTransport{Client: &http.Client{}}
+	client.url = server.URL
+
+	ctx, cancel := goctx.WithCancel(WithUser(goctx.Background(), &User{ID: "42"}))
+	go func() {
+		<-started
+		cancel()
+	}()
+	packet := NewPacket("boom")
+	if _, err := client.CaptureWithContext(ctx, packet, nil); err != goctx.Canceled {
+		t.Errorf("incorrect error: got %v, want %v", err, goctx.Canceled)
+	}
+	if !<-aborted {
+		t.Error("send was not aborted when the context was canceled")
+	}
+	client.Wait()
+	if !packet.hasInterface("user") {
+		t.Error("packet has no user from the context")
+	}
+	if failed := client.FailedEvents(); failed != 1 {
+		t.Errorf("incorrect number of failed events: got %d, want 1", failed)
+	}
+}
+
+func TestCaptureWithContextDone(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cancel()
+
+	if _, err := client.CaptureWithContext(ctx, NewPacket("boom"), nil); err != goctx.Canceled {
+		t.Errorf("incorrect error: got %v, want %v", err, goctx.Canceled)
+	}
+	client.Wait()
+	if packets := transport.Packets(); len(packets) != 0 {
+		t.Errorf("packet was sent with a done context: got %d packets", len(packets))
+	}
+}
+
+func tagValue(tags Tags, key string) string {
+	for _, tag := range tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package raven
+
+import (
+	"strconv"
+	"time"
+)
+
+// The maximum number of recent events remembered, above which those seen
+// longest ago are forgotten even if they are still within the dedup window.
+const maxDedupEvents = 1000
+
+// A dedupEntry records when the event with key was seen, in the order events
+// are remembered in.
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+func SetDedupWindow(window time.Duration) { DefaultClient.SetDedupWindow(window) }
+
+// SetDedupWindow sets the time during which events identical to one already
+// captured are suppressed, to avoid flooding Sentry with repeats of the same
+// error. Events are identical when they have the same message, and the same
+// exception type and top stack frame if they have an exception. Zero, the
+// default, disables the suppression.
+//
+// An event is remembered before the function set by SetBeforeSend is called,
+// so the repeats of an event it drops are suppressed without calling it again.
+func (client *Client) SetDedupWindow(window time.Duration) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.dedupWindow = window
+	client.dedupSeen = nil
+	client.dedupOrder = nil
+}
+
+// SuppressedEvents returns the number of events suppressed as duplicates of
+// one captured within the dedup window.
+func (client *Client) SuppressedEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.suppressed
+}
+
+func SuppressedEvents() uint64 { return DefaultClient.SuppressedEvents() }
+
+// isDuplicate reports whether the packet is identical to one captured within
+// the dedup window, and records it otherwise.
+func (client *Client) isDuplicate(packet *Packet) bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.dedupWindow <= 0 {
+		return false
+	}
+
+	key := dedupKey(packet)
+	now := timeNow()
+	if seen, ok := client.dedupSeen[key]; ok && now.Sub(seen) < client.dedupWindow {
+		client.statsMu.Lock()
+		client.suppressed++
+		client.statsMu.Unlock()
+		return true
+	}
+
+	if client.dedupSeen == nil {
+		client.dedupSeen = make(map[string]time.Time)
+	}
+	// Forget the events seen longest ago, at the front of the order, once they
+	// are out of the window or too many events are remembered. An entry is
+	// stale if its event was seen again since.
+	for len(client.dedupOrder) > 0 {
+		oldest := client.dedupOrder[0]
+		if now.Sub(oldest.seen) < client.dedupWindow && len(client.dedupSeen) < maxDedupEvents {
+			break
+		}
+		client.dedupOrder = client.dedupOrder[1:]
+		if seen := client.dedupSeen[oldest.key]; seen.Equal(oldest.seen) {
+			delete(client.dedupSeen, oldest.key)
+		}
+	}
+	client.dedupSeen[key] = now
+	client.dedupOrder = append(client.dedupOrder, dedupEntry{key, now})
+	return false
+}
+
+// dedupKey identifies the event of a packet by its message, and the type and
+// top stack frame of its outermost exception.
+func dedupKey(packet *Packet) string {
+	var ex *Exception
+	for _, inter := range packet.Interfaces {
+		switch inter := inter.(type) {
+		case *Exception:
+			ex = inter
+		case *Exceptions:
+			if len(inter.Values) > 0 {
+				ex = inter.Values[len(inter.Values)-1]
+			}
+		}
+	}
+
+	key := packet.Message
+	if ex != nil {
+		key += "\x00" + ex.Type
+		if ex.Stacktrace != nil && len(ex.Stacktrace.Frames) > 0 {
+			f := ex.Stacktrace.Frames[len(ex.Stacktrace.Frames)-1]
+			key += "\x00" + f.Module + "." + f.Function + ":" + strconv.Itoa(f.Lineno)
+		}
+	}
+	return key
+}
@@ -0,0 +1,83 @@
+package raven
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetDedupWindow(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	client, transport := newRecordingClient(t)
+	client.SetDedupWindow(time.Minute)
+	err := errors.New("boom")
+	for i := 0; i < 100; i++ {
+		client.CaptureError(err, nil)
+	}
+	client.CaptureError(errors.New("another boom"), nil)
+	client.Wait()
+
+	if packets := transport.Packets(); len(packets) != 2 {
+		t.Errorf("incorrect number of packets: got %d, want 2", len(packets))
+	}
+	if suppressed := client.SuppressedEvents(); suppressed != 99 {
+		t.Errorf("incorrect number of suppressed events: got %d, want 99", suppressed)
+	}
+
+	now = now.Add(time.Minute)
+	client.CaptureError(err, nil)
+	client.Wait()
+	if packets := transport.Packets(); len(packets) != 3 {
+		t.Errorf("incorrect number of packets after the window: got %d, want 3", len(packets))
+	}
+}
+
+func TestDedupWindowMaxEvents(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	client, _ := newRecordingClient(t)
+	client.SetDedupWindow(time.Hour)
+	for i := 0; i < 2*maxDedupEvents; i++ {
+		if client.isDuplicate(NewPacket(strconv.Itoa(i))) {
+			t.Fatalf("distinct event %d suppressed", i)
+		}
+		now = now.Add(time.Millisecond)
+	}
+
+	if len(client.dedupSeen) != maxDedupEvents || len(client.dedupOrder) != maxDedupEvents {
+		t.Errorf("incorrect number of remembered events: got %d and %d, want %d", len(client.dedupSeen), len(client.dedupOrder), maxDedupEvents)
+	}
+	if !client.isDuplicate(NewPacket(strconv.Itoa(2*maxDedupEvents - 1))) {
+		t.Error("most recent event was forgotten")
+	}
+	if client.isDuplicate(NewPacket("0")) {
+		t.Error("oldest event was not forgotten")
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	frame := func(line int) *Stacktrace {
+		return &Stacktrace{Frames: []*StacktraceFrame{{Module: "app", Function: "f", Lineno: line}}}
+	}
+	err := errors.New("boom")
+	key := dedupKey(NewPacket("boom", NewExceptions(err, frame(1))))
+	if key != dedupKey(NewPacket("boom", NewExceptions(err, frame(1)))) {
+		t.Error("identical events have different keys")
+	}
+	for _, packet := range []*Packet{
+		NewPacket("boom", NewExceptions(err, frame(2))),
+		NewPacket("boom", NewExceptions(&ignoredError{}, frame(1))),
+		NewPacket("other", NewExceptions(err, frame(1))),
+		NewPacket("boom"),
+	} {
+		if dedupKey(packet) == key {
+			t.Errorf("different event has the same key: %q", key)
+		}
+	}
+}
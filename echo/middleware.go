@@ -0,0 +1,99 @@
+// Package ravenecho provides Echo middleware that reports panics in handlers
+// and the errors they return to Sentry.
+//
+//	e := echo.New()
+//	e.Use(ravenecho.Middleware(nil, "request_id"))
+package ravenecho
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getsentry/raven-go"
+	"github.com/labstack/echo"
+)
+
+// Middleware returns middleware reporting panics in the handlers that follow
+// it, and the errors they return, through client, or raven.DefaultClient if
+// client is nil. Errors are still returned to be handled by Echo, and panics
+// are recovered and returned as errors, which Echo answers with a 500 status.
+// Errors of type *echo.HTTPError with a status below 500, such as those of
+// unknown routes, are not reported.
+//
+// Events carry the request, built by client.NewHttp, and have the route path,
+// such as "/orders/:id", as their transaction and route tag. They are also
+// tagged with each path parameter as echo.param.<name>, and with the value of
+// each of keys set on the echo.Context, under the key itself. The X-Sentry-ID
+// header of the response holds the ID of the event when the response hasn't
+// been written yet.
+func Middleware(client *raven.Client, keys ...string) echo.MiddlewareFunc {
+	if client == nil {
+		client = raven.DefaultClient
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			interfaces := []raven.Interface{client.NewHttp(c.Request())}
+			if path := c.Path(); path != "" {
+				interfaces = append(interfaces, raven.Transaction(path))
+			}
+
+			// The tags are read once the handler has returned or panicked, so
+			// that they include the values it set on the context
+			tags := make(map[string]string)
+			rval, eventID := client.CapturePanic(func() {
+				defer addTags(tags, c, keys)
+				err = next(c)
+			}, tags, interfaces...)
+
+			if rval != nil {
+				err = panicError(rval)
+			} else if reportable(err) {
+				eventID = client.CaptureError(err, tags, interfaces...)
+			}
+			if eventID != "" && !c.Response().Committed {
+				c.Response().Header().Set("X-Sentry-ID", eventID)
+			}
+			return err
+		}
+	}
+}
+
+// addTags adds the tags describing the route of c and the values of keys set
+// on it to tags.
+func addTags(tags map[string]string, c echo.Context, keys []string) {
+	if path := c.Path(); path != "" {
+		tags["route"] = path
+	}
+	values := c.ParamValues()
+	for i, name := range c.ParamNames() {
+		if i < len(values) {
+			tags["echo.param."+name] = values[i]
+		}
+	}
+	for _, key := range keys {
+		if value := c.Get(key); value != nil {
+			tags[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// reportable reports whether err returned by a handler is reported, leaving
+// out the errors of client requests such as echo.ErrNotFound.
+func reportable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if he, ok := err.(*echo.HTTPError); ok && he.Code < http.StatusInternalServerError {
+		return false
+	}
+	return true
+}
+
+// panicError returns the error returned in place of a handler that panicked
+// with rval.
+func panicError(rval interface{}) error {
+	if err, ok := rval.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", rval)
+}
@@ -0,0 +1,108 @@
+package ravenecho_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/getsentry/raven-go/echo"
+	"github.com/labstack/echo"
+)
+
+func newEcho(client *raven.Client) *echo.Echo {
+	e := echo.New()
+	e.Use(ravenecho.Middleware(client, "request_id"))
+	e.GET("/orders/:id", func(c echo.Context) error {
+		c.Set("request_id", "abc123")
+		panic("order not found")
+	})
+	e.GET("/payments/:id", func(c echo.Context) error {
+		c.Set("request_id", "def456")
+		return errors.New("payment declined")
+	})
+	e.GET("/ok", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	return e
+}
+
+func tagsOf(packet *raven.Packet) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range packet.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+func checkPacket(t *testing.T, w *httptest.ResponseRecorder, packet *raven.Packet, message, route, id, requestID string) {
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if packet == nil {
+		t.Fatal("event was not reported")
+	}
+	if got := w.Header().Get("X-Sentry-ID"); got != packet.EventID {
+		t.Errorf("incorrect X-Sentry-ID: got %q, want %q", got, packet.EventID)
+	}
+	if packet.Message != message {
+		t.Errorf("incorrect Message: got %s, want %s", packet.Message, message)
+	}
+	if packet.Transaction != route {
+		t.Errorf("incorrect Transaction: got %s, want %s", packet.Transaction, route)
+	}
+	tags := tagsOf(packet)
+	if tags["route"] != route || tags["echo.param.id"] != id || tags["request_id"] != requestID {
+		t.Errorf("incorrect tags: got %v", tags)
+	}
+
+	var h *raven.Http
+	for _, inter := range packet.Interfaces {
+		if i, ok := inter.(*raven.Http); ok {
+			h = i
+		}
+	}
+	if h == nil || h.Method != "GET" {
+		t.Errorf("incorrect request: got %+v", h)
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	w := httptest.NewRecorder()
+	newEcho(client).ServeHTTP(w, httptest.NewRequest("GET", "/orders/42", nil))
+	client.Wait()
+
+	packet := transport.LastEvent()
+	checkPacket(t, w, packet, "order not found", "/orders/:id", "42", "abc123")
+	if packet != nil && packet.Level != raven.FATAL {
+		t.Errorf("incorrect Level: got %s, want %s", packet.Level, raven.FATAL)
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	w := httptest.NewRecorder()
+	newEcho(client).ServeHTTP(w, httptest.NewRequest("GET", "/payments/7", nil))
+	client.Wait()
+
+	packet := transport.LastEvent()
+	checkPacket(t, w, packet, "payment declined", "/payments/:id", "7", "def456")
+	if packet != nil && packet.Level != raven.ERROR {
+		t.Errorf("incorrect Level: got %s, want %s", packet.Level, raven.ERROR)
+	}
+}
+
+func TestMiddlewareClientErrors(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	e := newEcho(client)
+	for _, path := range []string{"/ok", "/unknown"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	client.Wait()
+
+	if packet := transport.LastEvent(); packet != nil {
+		t.Errorf("unexpected event: got %s", packet.Message)
+	}
+}
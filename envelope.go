@@ -0,0 +1,97 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// The content type of envelopes.
+// https://develop.sentry.dev/sdk/envelopes/
+const envelopeContentType = "application/x-sentry-envelope"
+
+// SetUseEnvelope sets whether events are sent to the envelope endpoint of the
+// project instead of the legacy store endpoint, which is the default. Newer
+// Sentry servers and relays prefer envelopes, which HTTPTransport sends to the
+// URLs of envelope endpoints.
+func (client *Client) SetUseEnvelope(use bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.useEnvelope = use
+	client.url = endpointURL(client.url, use)
+	fallbacks := make([]dsnTarget, len(client.fallbacks))
+	for i, target := range client.fallbacks {
+		target.url = endpointURL(target.url, use)
+		fallbacks[i] = target
+	}
+	client.fallbacks = fallbacks
+}
+
+// SetUseEnvelope sets whether the default *Client sends events to the
+// envelope endpoint.
+func SetUseEnvelope(use bool) { DefaultClient.SetUseEnvelope(use) }
+
+// endpointURL returns the URL of either the envelope or the store endpoint of
+// the project whose events are sent to url, the URL of one of them.
+func endpointURL(url string, envelope bool) string {
+	if url == "" {
+		return ""
+	}
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "store/"), "envelope/")
+	if envelope {
+		return url + "envelope/"
+	}
+	return url + "store/"
+}
+
+// isEnvelopeURL reports whether url is the URL of an envelope endpoint.
+func isEnvelopeURL(url string) bool {
+	return strings.HasSuffix(url, "/envelope/")
+}
+
+// envelope returns an envelope holding the JSON of the packet as its event
+// item, followed by an item for each of its attachments.
+func envelope(packet *Packet, packetJSON []byte) ([]byte, error) {
+	header, err := json.Marshal(struct {
+		EventID string `json:"event_id"`
+		SentAt  string `json:"sent_at"`
+	}{packet.EventID, timeNow().UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return nil, err
+	}
+	itemHeader, err := json.Marshal(struct {
+		Type        string `json:"type"`
+		Length      int    `json:"length"`
+		ContentType string `json:"content_type"`
+	}{"event", len(packetJSON), "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(itemHeader)
+	buf.WriteByte('\n')
+	buf.Write(packetJSON)
+	buf.WriteByte('\n')
+
+	for _, a := range packet.attachments {
+		itemHeader, err := json.Marshal(struct {
+			Type        string `json:"type"`
+			Length      int    `json:"length"`
+			Filename    string `json:"filename"`
+			ContentType string `json:"content_type,omitempty"`
+		}{"attachment", len(a.Data), a.Filename, a.ContentType})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(itemHeader)
+		buf.WriteByte('\n')
+		buf.Write(a.Data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
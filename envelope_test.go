@@ -0,0 +1,109 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetUseEnvelope(t *testing.T) {
+	client, err := New("https://public@sentry.example.com/sentry/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetFallbackDSNs("https://public@fallback.example.com/2"); err != nil {
+		t.Fatal(err)
+	}
+	if actual := client.URL(); actual != "https://sentry.example.com/sentry/api/1/store/" {
+		t.Errorf("incorrect default URL: got %s", actual)
+	}
+
+	client.SetUseEnvelope(true)
+	if actual := client.URL(); actual != "https://sentry.example.com/sentry/api/1/envelope/" {
+		t.Errorf("incorrect envelope URL: got %s", actual)
+	}
+	if actual := client.fallbacks[0].url; actual != "https://fallback.example.com/api/2/envelope/" {
+		t.Errorf("incorrect fallback envelope URL: got %s", actual)
+	}
+	if err := client.SetDSN("https://public@other.example.com/3"); err != nil {
+		t.Fatal(err)
+	}
+	if actual := client.URL(); actual != "https://other.example.com/api/3/envelope/" {
+		t.Errorf("incorrect envelope URL after SetDSN: got %s", actual)
+	}
+
+	client.SetUseEnvelope(false)
+	if actual := client.URL(); actual != "https://other.example.com/api/3/store/" {
+		t.Errorf("incorrect store URL: got %s", actual)
+	}
+}
+
+func TestHTTPTransportEnvelope(t *testing.T) {
+	var body []byte
+	var path, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	client, err := New(strings.Replace(server.URL, "http://", "http://public@", 1) + "/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = &HTTPTransport{Client: &http.Client{}, CompressionThreshold: -1}
+	client.SetUseEnvelope(true)
+
+	eventID, err := client.CaptureAndWait(NewPacket("boom"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/1/envelope/" {
+		t.Errorf("incorrect path: got %s", path)
+	}
+	if contentType != envelopeContentType {
+		t.Errorf("incorrect Content-Type: got %s", contentType)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("incorrect number of envelope lines: got %d in %s", len(lines), body)
+	}
+	var header struct {
+		EventID string `json:"event_id"`
+		SentAt  string `json:"sent_at"`
+	}
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		t.Fatalf("invalid envelope header: %v", err)
+	}
+	if header.EventID != eventID || header.SentAt == "" {
+		t.Errorf("incorrect envelope header: got %s", lines[0])
+	}
+	var itemHeader struct {
+		Type   string `json:"type"`
+		Length int    `json:"length"`
+	}
+	if err := json.Unmarshal(lines[1], &itemHeader); err != nil {
+		t.Fatalf("invalid item header: %v", err)
+	}
+	if itemHeader.Type != "event" {
+		t.Errorf("incorrect item type: got %s, want event", itemHeader.Type)
+	}
+	if itemHeader.Length != len(lines[2]) {
+		t.Errorf("incorrect item length: got %d, want %d", itemHeader.Length, len(lines[2]))
+	}
+	var event struct {
+		EventID string `json:"event_id"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(lines[2], &event); err != nil {
+		t.Fatalf("invalid item payload: %v", err)
+	}
+	if event.EventID != eventID || event.Message != "boom" {
+		t.Errorf("incorrect item payload: got %s", lines[2])
+	}
+}
@@ -0,0 +1,53 @@
+package raven
+
+import (
+	"os"
+	"strings"
+)
+
+// The key of the extra data holding the environment variables of the process.
+const environExtraKey = "os.environ"
+
+// Keywords of environment variables whose values are redacted, in addition to
+// the sanitize fields. Credentials are passed in the environment under names
+// such as API_KEY or GITHUB_TOKEN, which the sanitize fields of requests don't
+// cover.
+var environSecretFields = []string{"token", "api_key", "apikey", "access_key", "private_key", "credential"}
+
+func SetIncludeEnvironment(include bool) { DefaultClient.SetIncludeEnvironment(include) }
+
+// SetIncludeEnvironment sets whether the environment variables of the process
+// are added to the extra data of every captured packet, under "os.environ".
+// The values of variables matching the sanitize fields or the keywords of
+// credentials, such as TOKEN or API_KEY, are redacted. They are left out by
+// default, since the environment often holds secrets under arbitrary names.
+func (client *Client) SetIncludeEnvironment(include bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.includeEnviron = include
+}
+
+// environ returns the environment variables of the process, with the values
+// of those matching fields or environSecretFields redacted.
+func environ(fields []string) map[string]interface{} {
+	fields = append(append([]string(nil), fields...), environSecretFields...)
+	valueRegexps := globalSanitizeValueRegexps()
+
+	vars := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			// Windows has variables such as =C: holding the working directory
+			// of drives
+			continue
+		}
+		key, value := kv[:i], kv[i+1:]
+		if isSecretField(key, fields) {
+			vars[key] = "********"
+		} else {
+			vars[key] = sanitizeValue(value, valueRegexps)
+		}
+	}
+	return vars
+}
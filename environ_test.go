@@ -0,0 +1,32 @@
+package raven
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetIncludeEnvironment(t *testing.T) {
+	os.Setenv("FOO", "bar")
+	os.Setenv("API_TOKEN", "xyz")
+	defer os.Unsetenv("FOO")
+	defer os.Unsetenv("API_TOKEN")
+
+	client, transport := NewTestClient()
+	client.CaptureMessageAndWait("boom", nil)
+	if _, ok := transport.LastEvent().Extra[environExtraKey]; ok {
+		t.Errorf("environment was included by default")
+	}
+
+	client.SetIncludeEnvironment(true)
+	client.CaptureMessageAndWait("boom", nil)
+	vars, ok := transport.LastEvent().Extra[environExtraKey].(map[string]interface{})
+	if !ok {
+		t.Fatalf("incorrect environment: got %#v", transport.LastEvent().Extra[environExtraKey])
+	}
+	if vars["FOO"] != "bar" {
+		t.Errorf("incorrect FOO: got %v, want bar", vars["FOO"])
+	}
+	if vars["API_TOKEN"] != "********" {
+		t.Errorf("API_TOKEN was not redacted: got %v", vars["API_TOKEN"])
+	}
+}
@@ -1,6 +1,7 @@
 package raven
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,3 +27,16 @@ func Example() {
 	message := fmt.Sprintf("Captured error with id %s: %q", eventID, raisedErr)
 	log.Println(message)
 }
+
+func ExampleNewTestClient() {
+	client, transport := NewTestClient()
+
+	// Run the code reporting events, with client or with DefaultClient
+	// replaced by it
+	client.CaptureError(errors.New("order not found"), map[string]string{"order": "42"})
+	client.Wait()
+
+	event := transport.LastEvent()
+	fmt.Println(event.Message, event.Level)
+	// Output: order not found error
+}
@@ -39,3 +39,78 @@ func (e *Exception) Culprit() string {
 	}
 	return e.Stacktrace.Culprit()
 }
+
+// NewExceptions returns the chain of errors wrapped by err, found through
+// their Cause or Unwrap methods, with the innermost cause first and err last.
+// The stacktrace is attached to err. Wrappers whose message is the same as
+// that of the error they wrap, such as those adding only a stack trace, are
+// left out.
+func NewExceptions(err error, stacktrace *Stacktrace) *Exceptions {
+	chain := []error{err}
+	for i := 1; i < maxErrorDepth; i++ {
+		cause := errorCause(err)
+		if cause == nil {
+			break
+		}
+		if cause.Error() == err.Error() {
+			chain = chain[:len(chain)-1]
+		}
+		chain = append(chain, cause)
+		err = cause
+	}
+
+	exs := &Exceptions{Values: make([]*Exception, len(chain))}
+	for i, err := range chain {
+		exs.Values[len(chain)-1-i] = NewException(err, nil)
+	}
+	exs.Values[len(chain)-1].Stacktrace = stacktrace
+	return exs
+}
+
+// https://docs.sentry.io/clientdev/interfaces/exception/
+type Exceptions struct {
+	// Required
+	Values []*Exception `json:"values"`
+}
+
+func (e *Exceptions) Class() string { return "exception" }
+
+func (e *Exceptions) Culprit() string {
+	for i := len(e.Values) - 1; i >= 0; i-- {
+		if culprit := e.Values[i].Culprit(); culprit != "" {
+			return culprit
+		}
+	}
+	return ""
+}
+
+// FingerprintByErrorType sets the Fingerprint of a packet holding exceptions to
+// their types, from the outermost error to its innermost cause, so that Sentry
+// groups events by the types of their errors regardless of their messages and
+// stack traces. For example, every *net.OpError is grouped together. It can be
+// set as the BeforeSend function of a client, or called by one:
+//
+//	raven.SetBeforeSend(raven.FingerprintByErrorType)
+//
+// Packets without exceptions, or whose Fingerprint is already set, are left as
+// they are.
+func FingerprintByErrorType(packet *Packet) *Packet {
+	if len(packet.Fingerprint) > 0 {
+		return packet
+	}
+	var types []string
+	for _, inter := range packet.Interfaces {
+		switch ex := inter.(type) {
+		case *Exception:
+			types = append(types, ex.Type)
+		case *Exceptions:
+			for i := len(ex.Values) - 1; i >= 0; i-- {
+				types = append(types, ex.Values[i].Type)
+			}
+		}
+	}
+	if len(types) > 0 {
+		packet.Fingerprint = types
+	}
+	return packet
+}
@@ -3,6 +3,7 @@ package raven
 import (
 	"encoding/json"
 	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -37,3 +38,84 @@ func TestNewException_JSON(t *testing.T) {
 		t.Errorf("incorrect JSON: got %s, want %s", string(b), expected)
 	}
 }
+
+type testWrapError struct {
+	msg   string
+	cause error
+}
+
+func (e *testWrapError) Error() string { return e.msg + " (" + e.cause.Error() + ")" }
+
+func (e *testWrapError) Unwrap() error { return e.cause }
+
+func TestNewExceptions(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := &testWrapError{"save failed", &testWrapError{"query failed", cause}}
+	stacktrace := &Stacktrace{Frames: []*StacktraceFrame{{Module: "app", Function: "save", InApp: true}}}
+
+	exs := NewExceptions(err, stacktrace)
+	expected := []string{
+		"connection refused",
+		"query failed (connection refused)",
+		"save failed (query failed (connection refused))",
+	}
+	if len(exs.Values) != len(expected) {
+		t.Fatalf("incorrect number of exceptions: got %d, want %d", len(exs.Values), len(expected))
+	}
+	for i, value := range expected {
+		if exs.Values[i].Value != value {
+			t.Errorf("incorrect Value %d: got %s, want %s", i, exs.Values[i].Value, value)
+		}
+	}
+	if exs.Values[0].Type != "*errors.errorString" || exs.Values[2].Type != "*raven.testWrapError" {
+		t.Errorf("incorrect Types: got %s and %s", exs.Values[0].Type, exs.Values[2].Type)
+	}
+	if exs.Values[0].Stacktrace != nil || exs.Values[2].Stacktrace != stacktrace {
+		t.Error("stacktrace should only be attached to the outermost error")
+	}
+	if culprit := exs.Culprit(); culprit != "app.save" {
+		t.Errorf("incorrect Culprit: got %s, want app.save", culprit)
+	}
+}
+
+type testCycleError struct{}
+
+func (e *testCycleError) Error() string { return "cycle" }
+
+func (e *testCycleError) Unwrap() error { return &testWrapError{"again", e} }
+
+func TestNewExceptionsDepth(t *testing.T) {
+	exs := NewExceptions(&testCycleError{}, nil)
+	if len(exs.Values) != maxErrorDepth {
+		t.Errorf("incorrect number of exceptions: got %d, want %d", len(exs.Values), maxErrorDepth)
+	}
+}
+
+func TestFingerprintByErrorType(t *testing.T) {
+	client, transport := NewTestClient()
+	client.SetBeforeSend(FingerprintByErrorType)
+
+	var fingerprints [][]string
+	for _, err := range []error{
+		&testWrapError{"saving order 1", errors.New("connection refused")},
+		&testWrapError{"saving order 2", errors.New("connection reset")},
+	} {
+		client.CaptureErrorAndWait(err, nil)
+		fingerprints = append(fingerprints, transport.LastEvent().Fingerprint)
+	}
+	expected := []string{"*raven.testWrapError", "*errors.errorString"}
+	for _, fingerprint := range fingerprints {
+		if !reflect.DeepEqual(fingerprint, expected) {
+			t.Errorf("incorrect Fingerprint: got %v, want %v", fingerprint, expected)
+		}
+	}
+
+	client.CaptureErrorAndWait(errors.New("boom"), nil, Fingerprint{"custom"})
+	if fingerprint := transport.LastEvent().Fingerprint; !reflect.DeepEqual(fingerprint, []string{"custom"}) {
+		t.Errorf("supplied Fingerprint was replaced: got %v", fingerprint)
+	}
+	client.CaptureMessageAndWait("boom", nil)
+	if fingerprint := transport.LastEvent().Fingerprint; fingerprint != nil {
+		t.Errorf("message was fingerprinted: got %v", fingerprint)
+	}
+}
@@ -0,0 +1,178 @@
+package raven
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedElements parses the RFC 7239 Forwarded headers into one map
+// of lowercased parameter names to unquoted values per forwarded element,
+// ordered from the originating client to the last proxy.
+func forwardedElements(header http.Header) []map[string]string {
+	var elements []map[string]string
+	for _, value := range header["Forwarded"] {
+		for _, element := range splitQuoted(value, ',') {
+			params := make(map[string]string)
+			for _, pair := range splitQuoted(element, ';') {
+				idx := strings.Index(pair, "=")
+				if idx == -1 {
+					continue
+				}
+				key := strings.ToLower(strings.TrimSpace(pair[:idx]))
+				params[key] = unquote(strings.TrimSpace(pair[idx+1:]))
+			}
+			elements = append(elements, params)
+		}
+	}
+	return elements
+}
+
+// splitQuoted splits s around each instance of sep that is not inside a
+// quoted string.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// forwardedNode splits the value of a Forwarded "for" parameter into its
+// address and optional port. Unknown and obfuscated identifiers yield an
+// empty address.
+func forwardedNode(node string) (addr, port string) {
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end == -1 {
+			return "", ""
+		}
+		addr = node[1:end]
+		if strings.HasPrefix(node[end+1:], ":") {
+			port = node[end+2:]
+		}
+	} else if idx := strings.Index(node, ":"); idx != -1 && strings.Count(node, ":") == 1 {
+		addr, port = node[:idx], node[idx+1:]
+	} else {
+		addr = node
+	}
+	addr, ok := ipAddr(addr)
+	if !ok {
+		return "", ""
+	}
+	if strings.HasPrefix(port, "_") {
+		port = ""
+	}
+	return addr, port
+}
+
+// clientAddr returns the address and port of the client that made req. When
+// trustProxy is set, the Forwarded and X-Forwarded-For headers are consulted
+// before req.RemoteAddr.
+func clientAddr(req *http.Request, trustProxy bool) (addr, port string, ok bool) {
+	if trustProxy {
+		for _, element := range forwardedElements(req.Header) {
+			if node, found := element["for"]; found {
+				if addr, port = forwardedNode(node); addr != "" {
+					return addr, port, true
+				}
+				break
+			}
+		}
+		if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+			hop := strings.TrimSpace(strings.Split(xff, ",")[0])
+			if net.ParseIP(hop) != nil {
+				return hop, "", true
+			}
+		}
+	}
+	addr, port, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		// Some servers leave the port out, which SplitHostPort rejects, and
+		// a bare IPv6 address is split at one of its colons
+		addr, port = req.RemoteAddr, ""
+		if _, ok := ipAddr(addr); !ok {
+			return "", "", false
+		}
+	}
+	addr, _ = ipAddr(addr)
+	return addr, port, true
+}
+
+// ipAddr returns addr without the brackets or zone ID it may have, such as
+// those of [fe80::1%eth0], and reports whether it is an IP address. The zone
+// ID is left out since it is only meaningful on the host it was seen on.
+func ipAddr(addr string) (string, bool) {
+	if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		addr = addr[1 : len(addr)-1]
+	}
+	if idx := strings.Index(addr, "%"); idx != -1 && strings.Contains(addr, ":") {
+		addr = addr[:idx]
+	}
+	return addr, net.ParseIP(addr) != nil
+}
+
+// requestHost returns the host the client requested, formatted for a URL.
+// When trustProxy is set, the Forwarded and X-Forwarded-Host headers are
+// consulted before req.Host.
+func requestHost(req *http.Request, trustProxy bool) string {
+	if trustProxy {
+		for _, element := range forwardedElements(req.Header) {
+			if host := element["host"]; host != "" {
+				return urlHost(host)
+			}
+		}
+		if xfh := req.Header.Get("X-Forwarded-Host"); xfh != "" {
+			if host := strings.TrimSpace(strings.Split(xfh, ",")[0]); host != "" {
+				return urlHost(host)
+			}
+		}
+	}
+	return urlHost(req.Host)
+}
+
+// urlHost brackets a bare IPv6 address, optionally followed by a zone ID, and
+// escapes the percent sign of the zone ID, as required in the host of a URL
+// (RFC 6874). Other hosts, with or without a port, are returned unchanged.
+func urlHost(host string) string {
+	var rest string
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end == -1 {
+			return host
+		}
+		host, rest = host[1:end], host[end+1:]
+	} else if strings.Count(host, ":") < 2 {
+		return host
+	}
+	if idx := strings.Index(host, "%"); idx != -1 && !strings.HasPrefix(host[idx:], "%25") {
+		host = host[:idx] + "%25" + host[idx+1:]
+	}
+	return "[" + host + "]" + rest
+}
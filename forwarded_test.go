@@ -0,0 +1,157 @@
+package raven
+
+import (
+	"reflect"
+	"testing"
+)
+
+var forwardedElementsTests = []struct {
+	headers  []string
+	elements []map[string]string
+}{
+	{
+		[]string{`for=192.0.2.60;proto=http;by=203.0.113.43`},
+		[]map[string]string{{"for": "192.0.2.60", "proto": "http", "by": "203.0.113.43"}},
+	},
+	{
+		[]string{`For="[2001:db8:cafe::17]:4711", for=198.51.100.17`, `for=unknown`},
+		[]map[string]string{{"for": "[2001:db8:cafe::17]:4711"}, {"for": "198.51.100.17"}, {"for": "unknown"}},
+	},
+	{
+		[]string{`for="_a;b,c";host="example.com"`},
+		[]map[string]string{{"for": "_a;b,c", "host": "example.com"}},
+	},
+}
+
+func TestForwardedElements(t *testing.T) {
+	for _, test := range forwardedElementsTests {
+		actual := forwardedElements(map[string][]string{"Forwarded": test.headers})
+		if !reflect.DeepEqual(actual, test.elements) {
+			t.Errorf("incorrect elements for %q: got %+v, want %+v", test.headers, actual, test.elements)
+		}
+	}
+}
+
+var forwardedNodeTests = []struct {
+	node, addr, port string
+}{
+	{"192.0.2.43", "192.0.2.43", ""},
+	{"192.0.2.43:47011", "192.0.2.43", "47011"},
+	{"[2001:db8:cafe::17]:4711", "2001:db8:cafe::17", "4711"},
+	{"[2001:db8:cafe::17]", "2001:db8:cafe::17", ""},
+	{"[fe80::1%eth0]:4711", "fe80::1", "4711"},
+	{"192.0.2.43:_hidden", "192.0.2.43", ""},
+	{"unknown", "", ""},
+	{"_gazonk", "", ""},
+}
+
+func TestForwardedNode(t *testing.T) {
+	for _, test := range forwardedNodeTests {
+		addr, port := forwardedNode(test.node)
+		if addr != test.addr || port != test.port {
+			t.Errorf("incorrect node %q: got %s %s, want %s %s", test.node, addr, port, test.addr, test.port)
+		}
+	}
+}
+
+var clientAddrTests = []struct {
+	headers    map[string]string
+	trustProxy bool
+	env        map[string]string
+}{
+	{
+		map[string]string{"Forwarded": `for="[2001:db8::1]:443"`, "X-Forwarded-For": "198.51.100.17"},
+		true,
+		map[string]string{"REMOTE_ADDR": "2001:db8::1", "REMOTE_PORT": "443"},
+	},
+	{
+		map[string]string{"X-Forwarded-For": "198.51.100.17, 10.0.0.1"},
+		true,
+		map[string]string{"REMOTE_ADDR": "198.51.100.17"},
+	},
+	{
+		map[string]string{"Forwarded": "for=unknown"},
+		true,
+		map[string]string{"REMOTE_ADDR": "127.0.0.1", "REMOTE_PORT": "8000"},
+	},
+	{
+		map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "198.51.100.17"},
+		false,
+		map[string]string{"REMOTE_ADDR": "127.0.0.1", "REMOTE_PORT": "8000"},
+	},
+}
+
+func TestNewHttpClientAddr(t *testing.T) {
+	for _, test := range clientAddrTests {
+		client := &Client{}
+		client.SetTrustProxyHeaders(test.trustProxy)
+
+		req := newBaseRequest()
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		actual := client.NewHttp(req)
+		if !reflect.DeepEqual(actual.Env, test.env) {
+			t.Errorf("incorrect Env for %v: got %+v, want %+v", test.headers, actual.Env, test.env)
+		}
+	}
+}
+
+var requestHostTests = []struct {
+	headers    map[string]string
+	trustProxy bool
+	url        string
+}{
+	{map[string]string{"X-Forwarded-Host": "public.example.com"}, true, "http://public.example.com/"},
+	{map[string]string{"X-Forwarded-Host": "public.example.com, internal"}, true, "http://public.example.com/"},
+	{map[string]string{"Forwarded": `for=192.0.2.60;host="forwarded.example.com"`, "X-Forwarded-Host": "public.example.com"}, true, "http://forwarded.example.com/"},
+	{map[string]string{"Forwarded": `host=forwarded.example.com`, "X-Forwarded-Host": "public.example.com"}, false, "http://example.com/"},
+	{map[string]string{}, true, "http://example.com/"},
+}
+
+func TestNewHttpRequestHost(t *testing.T) {
+	for _, test := range requestHostTests {
+		client := &Client{}
+		client.SetTrustProxyHeaders(test.trustProxy)
+
+		req := newBaseRequest()
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		actual := client.NewHttp(req)
+		if actual.URL != test.url {
+			t.Errorf("incorrect URL for %v: got %s, want %s", test.headers, actual.URL, test.url)
+		}
+	}
+}
+
+var ipv6Tests = []struct {
+	remoteAddr string
+	host       string
+	env        map[string]string
+	url        string
+}{
+	{"[2001:db8::1]:443", "[2001:db8::2]:8080", map[string]string{"REMOTE_ADDR": "2001:db8::1", "REMOTE_PORT": "443"}, "http://[2001:db8::2]:8080/"},
+	{"[fe80::1%eth0]:443", "[fe80::2%eth0]", map[string]string{"REMOTE_ADDR": "fe80::1", "REMOTE_PORT": "443"}, "http://[fe80::2%25eth0]/"},
+	{"2001:db8::1", "2001:db8::2", map[string]string{"REMOTE_ADDR": "2001:db8::1"}, "http://[2001:db8::2]/"},
+	{"fe80::1%eth0", "fe80::2%eth0", map[string]string{"REMOTE_ADDR": "fe80::1"}, "http://[fe80::2%25eth0]/"},
+	{"[::1]", "[::1]:8080", map[string]string{"REMOTE_ADDR": "::1"}, "http://[::1]:8080/"},
+	{"@", "example.com", nil, "http://example.com/"},
+}
+
+func TestNewHttpIPv6(t *testing.T) {
+	for _, test := range ipv6Tests {
+		req := newBaseRequest()
+		req.RemoteAddr, req.Host = test.remoteAddr, test.host
+
+		actual := (&Client{}).NewHttp(req)
+		if !reflect.DeepEqual(actual.Env, test.env) {
+			t.Errorf("incorrect Env for %s: got %+v, want %+v", test.remoteAddr, actual.Env, test.env)
+		}
+		if actual.URL != test.url {
+			t.Errorf("incorrect URL for %s: got %s, want %s", test.host, actual.URL, test.url)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Package ravengin provides Gin middleware that reports panics in handlers to
+// Sentry.
+//
+//	router := gin.New()
+//	router.Use(ravengin.Recovery(nil))
+package ravengin
+
+import (
+	"net/http"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery returns middleware recovering and reporting panics in the handlers
+// that follow it through client, or raven.DefaultClient if client is nil.
+//
+// The event of a panic carries the request, built by client.NewHttp, and is
+// tagged with the name of the handler as gin.handler and with each path
+// parameter as gin.param.<name>. The route pattern, such as "/orders/:id", is
+// its transaction. The request is then aborted with a 500 status and an
+// X-Sentry-ID header holding the ID of the event, unless the handler already
+// wrote a response.
+func Recovery(client *raven.Client) gin.HandlerFunc {
+	if client == nil {
+		client = raven.DefaultClient
+	}
+	return func(c *gin.Context) {
+		tags := map[string]string{"gin.handler": c.HandlerName()}
+		for _, param := range c.Params {
+			tags["gin.param."+param.Key] = param.Value
+		}
+		interfaces := []raven.Interface{client.NewHttp(c.Request)}
+		if route := c.FullPath(); route != "" {
+			interfaces = append(interfaces, raven.Transaction(route))
+		}
+
+		rval, eventID := client.CapturePanic(c.Next, tags, interfaces...)
+		if rval == nil {
+			return
+		}
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		if eventID != "" {
+			c.Header("X-Sentry-ID", eventID)
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
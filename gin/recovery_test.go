@@ -0,0 +1,109 @@
+package ravengin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/getsentry/raven-go/gin"
+	"github.com/gin-gonic/gin"
+)
+
+func getOrder(c *gin.Context) {
+	panic("order not found")
+}
+
+func newRouter(client *raven.Client) *gin.Engine {
+	router := gin.New()
+	router.Use(ravengin.Recovery(client))
+	router.GET("/orders/:id", getOrder)
+	router.GET("/written", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "accepted")
+		panic("after writing")
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+func TestRecovery(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	w := httptest.NewRecorder()
+	newRouter(client).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/orders/42?password=secret", nil))
+	client.Wait()
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	packet := transport.LastEvent()
+	if packet == nil {
+		t.Fatal("panic was not reported")
+	}
+	if id := w.Header().Get("X-Sentry-ID"); id != packet.EventID {
+		t.Errorf("incorrect X-Sentry-ID: got %q, want %q", id, packet.EventID)
+	}
+	if packet.Message != "order not found" {
+		t.Errorf("incorrect Message: got %s", packet.Message)
+	}
+	if packet.Transaction != "/orders/:id" {
+		t.Errorf("incorrect Transaction: got %s, want /orders/:id", packet.Transaction)
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range packet.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	if tags["gin.param.id"] != "42" {
+		t.Errorf("incorrect gin.param.id tag: got %q, want 42", tags["gin.param.id"])
+	}
+	if !strings.HasSuffix(tags["gin.handler"], "getOrder") {
+		t.Errorf("incorrect gin.handler tag: got %q", tags["gin.handler"])
+	}
+
+	var h *raven.Http
+	for _, inter := range packet.Interfaces {
+		if i, ok := inter.(*raven.Http); ok {
+			h = i
+		}
+	}
+	if h == nil {
+		t.Fatal("request was not reported")
+	}
+	if h.Method != "GET" || h.URL != "http://example.com/orders/42" {
+		t.Errorf("incorrect request: got %s %s", h.Method, h.URL)
+	}
+	if strings.Contains(h.Query, "secret") {
+		t.Errorf("query was not sanitized: got %s", h.Query)
+	}
+}
+
+func TestRecoveryAfterWriting(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	w := httptest.NewRecorder()
+	newRouter(client).ServeHTTP(w, httptest.NewRequest("GET", "/written", nil))
+	client.Wait()
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if transport.LastEvent() == nil {
+		t.Error("panic was not reported")
+	}
+}
+
+func TestRecoveryWithoutPanic(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	w := httptest.NewRecorder()
+	newRouter(client).ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	client.Wait()
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("incorrect response: got %d %q", w.Code, w.Body.String())
+	}
+	if packet := transport.LastEvent(); packet != nil {
+		t.Errorf("unexpected event: got %+v", packet)
+	}
+}
@@ -0,0 +1,147 @@
+package raven
+
+import (
+	"bufio"
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Threads describe the goroutines running when an event happened, each with
+// its own stacktrace.
+//
+// https://docs.sentry.io/clientdev/interfaces/threads/
+type Threads struct {
+	Values []*Thread `json:"values"`
+}
+
+func (t *Threads) Class() string { return "threads" }
+
+type Thread struct {
+	ID         int         `json:"id"`
+	Name       string      `json:"name,omitempty"`
+	Current    bool        `json:"current,omitempty"`
+	Crashed    bool        `json:"crashed,omitempty"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
+// NewThreads parses the stacks of all goroutines, as formatted by
+// runtime.Stack(buf, true), into threads. The first goroutine of the dump is
+// the one that called runtime.Stack, so it is marked as the current thread.
+// Each thread is named after the header of its goroutine, such as
+// "goroutine 7 [chan receive]".
+//
+// context and appPackagePrefixes are the same as for NewStacktrace.
+func NewThreads(dump []byte, context int, appPackagePrefixes []string) *Threads {
+	threads := &Threads{}
+	var thread *Thread
+	var frames []*StacktraceFrame
+	finish := func() {
+		if thread != nil {
+			thread.Stacktrace = newStacktrace(frames)
+			threads.Values = append(threads.Values, thread)
+		}
+		thread, frames = nil, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	var function string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			finish()
+			thread = parseGoroutineHeader(line)
+			thread.Current = len(threads.Values) == 0
+			function = ""
+		case thread == nil || line == "" || strings.HasPrefix(line, "..."):
+		case strings.HasPrefix(line, "\t"):
+			if function == "" {
+				continue
+			}
+			file, lineno := parseGoroutineLocation(line)
+			pack, name := splitFunctionName(function)
+			if frame := newStacktraceFrame(pack, name, file, lineno, context, appPackagePrefixes); frame != nil {
+				frames = append(frames, frame)
+			}
+			function = ""
+		default:
+			function = parseGoroutineFunction(line)
+		}
+	}
+	finish()
+	return threads
+}
+
+// parseGoroutineHeader returns the thread of a header such as
+// "goroutine 7 [chan receive]:".
+func parseGoroutineHeader(line string) *Thread {
+	name := strings.TrimSuffix(line, ":")
+	fields := strings.Fields(name)
+	id, _ := strconv.Atoi(fields[1])
+	return &Thread{ID: id, Name: name}
+}
+
+// parseGoroutineFunction returns the function called in a line such as
+// "main.(*T).run(0xc42000e1e0, 0x1)" or "created by main.main in goroutine 1".
+func parseGoroutineFunction(line string) string {
+	if strings.HasPrefix(line, "created by ") {
+		line = strings.TrimPrefix(line, "created by ")
+		if idx := strings.Index(line, " in goroutine "); idx != -1 {
+			line = line[:idx]
+		}
+		return line
+	}
+	if strings.HasSuffix(line, ")") {
+		if idx := strings.LastIndex(line, "("); idx > 0 {
+			line = line[:idx]
+		}
+	}
+	return line
+}
+
+// parseGoroutineLocation returns the file and line of a location such as
+// "\t/go/src/main.go:12 +0x1d".
+func parseGoroutineLocation(line string) (string, int) {
+	line = strings.TrimSpace(line)
+	if idx := strings.LastIndex(line, " +0x"); idx != -1 {
+		line = line[:idx]
+	}
+	idx := strings.LastIndex(line, ":")
+	if idx == -1 {
+		return line, 0
+	}
+	lineno, _ := strconv.Atoi(line[idx+1:])
+	return line[:idx], lineno
+}
+
+// The extra data key of the goroutine dump added to panics.
+const goroutinesExtraKey = "goroutines"
+
+func SetGoroutineDumpBytes(n int) { DefaultClient.SetGoroutineDumpBytes(n) }
+
+// SetGoroutineDumpBytes sets the maximum size in bytes of the stacks of all
+// goroutines, as formatted by runtime.Stack, added to the extra data of the
+// packets reporting a panic. A dump larger than n is truncated. Dumps are not
+// added by default, or when n is 0, since they may be very large.
+func (client *Client) SetGoroutineDumpBytes(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.goroutineDumpBytes = n
+}
+
+// goroutineDump returns the stacks of all goroutines, or "" if dumps are
+// disabled.
+func (client *Client) goroutineDump() string {
+	client.mu.RLock()
+	n := client.goroutineDumpBytes
+	client.mu.RUnlock()
+
+	if n <= 0 {
+		return ""
+	}
+	buf := make([]byte, n)
+	return string(buf[:runtime.Stack(buf, true)])
+}
@@ -0,0 +1,145 @@
+package raven
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPanicGoroutineDump(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.CapturePanic(func() { panic("boom") }, nil)
+	client.SetGoroutineDumpBytes(1 << 20)
+
+	// Keep another goroutine running while the panic is reported
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		<-release
+	}()
+	<-started
+	client.CapturePanic(func() { panic("boom") }, nil)
+	close(release)
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets: got %d, want 2", len(packets))
+	}
+	if _, ok := packets[0].Extra[goroutinesExtraKey]; ok {
+		t.Error("goroutine dump added without SetGoroutineDumpBytes")
+	}
+	dump, _ := packets[1].Extra[goroutinesExtraKey].(string)
+	if count := strings.Count("\n"+dump, "\ngoroutine "); count < 2 {
+		t.Errorf("incorrect number of goroutines in the dump: got %d, want at least 2\n%s", count, dump)
+	}
+}
+
+func TestPanicGoroutineDumpNotTruncated(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.SetGoroutineDumpBytes(1 << 20)
+
+	// Keep enough goroutines running for the dump to exceed the extra limit
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		started.Add(1)
+		go func() {
+			started.Done()
+			<-release
+		}()
+	}
+	started.Wait()
+	client.CapturePanic(func() { panic("boom") }, nil)
+	close(release)
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	dump, _ := packets[0].Extra[goroutinesExtraKey].(string)
+	if len(dump) <= defaultMaxExtraValueLength {
+		t.Fatalf("dump is not larger than the extra limit: got %d bytes", len(dump))
+	}
+	if count := strings.Count("\n"+dump, "\ngoroutine "); count < 500 {
+		t.Errorf("incorrect number of goroutines in the dump: got %d, want at least 500", count)
+	}
+}
+
+func TestGoroutineDumpTruncated(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	client.SetGoroutineDumpBytes(100)
+	if dump := client.goroutineDump(); len(dump) != 100 {
+		t.Errorf("incorrect dump size: got %d, want 100", len(dump))
+	}
+}
+
+const goroutineDump = `goroutine 1 [running]:
+main.main.func1()
+	/go/src/app/main.go:20 +0x45
+panic({0x559dc0?, 0x4a4920?})
+	/usr/local/go/src/runtime/panic.go:859 +0x125
+main.main()
+	/go/src/app/main.go:22 +0xc9
+
+goroutine 6 [chan receive, 2 minutes]:
+app/worker.(*Worker).run(...)
+	/go/src/app/worker/worker.go:11
+created by main.main in goroutine 1
+	/go/src/app/main.go:15 +0x98
+`
+
+func TestNewThreads(t *testing.T) {
+	threads := NewThreads([]byte(goroutineDump), 0, []string{"app"})
+	if len(threads.Values) != 2 {
+		t.Fatalf("incorrect number of threads: got %d, want 2", len(threads.Values))
+	}
+
+	for i, expected := range []struct {
+		id      int
+		name    string
+		current bool
+		frames  []StacktraceFrame
+	}{
+		{1, "goroutine 1 [running]", true, []StacktraceFrame{
+			{Module: "main", Function: "main", AbsolutePath: "/go/src/app/main.go", Lineno: 22, InApp: true},
+			{Module: "", Function: "panic", AbsolutePath: "/usr/local/go/src/runtime/panic.go", Lineno: 859},
+			{Module: "main", Function: "main.func1", AbsolutePath: "/go/src/app/main.go", Lineno: 20, InApp: true},
+		}},
+		{6, "goroutine 6 [chan receive, 2 minutes]", false, []StacktraceFrame{
+			{Module: "main", Function: "main", AbsolutePath: "/go/src/app/main.go", Lineno: 15, InApp: true},
+			{Module: "app/worker", Function: "(*Worker).run", AbsolutePath: "/go/src/app/worker/worker.go", Lineno: 11, InApp: true},
+		}},
+	} {
+		thread := threads.Values[i]
+		if thread.ID != expected.id || thread.Name != expected.name || thread.Current != expected.current {
+			t.Errorf("incorrect thread %d: got (%d, %q, %t), want (%d, %q, %t)", i, thread.ID, thread.Name, thread.Current, expected.id, expected.name, expected.current)
+		}
+		if thread.Stacktrace == nil || len(thread.Stacktrace.Frames) != len(expected.frames) {
+			t.Errorf("incorrect frames of thread %d: got %#v", i, thread.Stacktrace)
+			continue
+		}
+		for j, frame := range thread.Stacktrace.Frames {
+			actual := StacktraceFrame{Module: frame.Module, Function: frame.Function, AbsolutePath: frame.AbsolutePath, Lineno: frame.Lineno, InApp: frame.InApp}
+			if !reflect.DeepEqual(actual, expected.frames[j]) {
+				t.Errorf("incorrect frame %d of thread %d: got %+v, want %+v", j, i, actual, expected.frames[j])
+			}
+		}
+	}
+}
+
+func TestNewThreadsFromRuntime(t *testing.T) {
+	buf := make([]byte, 1<<20)
+	threads := NewThreads(buf[:runtime.Stack(buf, true)], 0, nil)
+	if len(threads.Values) == 0 || !threads.Values[0].Current {
+		t.Fatalf("incorrect threads: got %#v", threads.Values)
+	}
+	frames := threads.Values[0].Stacktrace.Frames
+	if f := frames[len(frames)-1]; f.Module != thisPackage || f.Function != "TestNewThreadsFromRuntime" {
+		t.Errorf("incorrect top frame: got %s.%s, want %s.TestNewThreadsFromRuntime", f.Module, f.Function, thisPackage)
+	}
+}
@@ -0,0 +1,80 @@
+// Package ravengrpc provides gRPC server interceptors that report panics in
+// handlers to Sentry.
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(ravengrpc.UnaryServerInterceptor(nil)),
+//		grpc.StreamInterceptor(ravengrpc.StreamServerInterceptor(nil)),
+//	)
+package ravengrpc
+
+import (
+	"context"
+
+	"github.com/getsentry/raven-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor recovering and reporting
+// panics in unary handlers through client, or raven.DefaultClient if client is
+// nil. The event of a panic is named after the method and carries the
+// incoming metadata, sanitized as request headers are. The call then fails
+// with codes.Internal.
+func UnaryServerInterceptor(client *raven.Client) grpc.UnaryServerInterceptor {
+	if client == nil {
+		client = raven.DefaultClient
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if rval := recover(); rval != nil {
+				resp, err = nil, reportPanic(client, rval, ctx, info.FullMethod)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recovering and reporting
+// panics in stream handlers the same way as UnaryServerInterceptor.
+func StreamServerInterceptor(client *raven.Client) grpc.StreamServerInterceptor {
+	if client == nil {
+		client = raven.DefaultClient
+	}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if rval := recover(); rval != nil {
+				err = reportPanic(client, rval, ss.Context(), info.FullMethod)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// reportPanic reports the panic rval of the handler of a call to method and
+// returns the error the call fails with. It must be called from the deferred
+// function recovering the panic.
+//
+// gRPC calls are HTTP/2 POST requests to the path of the method, so the
+// metadata is reported as the headers of such a request.
+func reportPanic(client *raven.Client, rval interface{}, ctx context.Context, method string) error {
+	h := &raven.Http{Method: "POST", URL: method}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		h.Headers = client.SanitizeValues(md)
+	}
+	var eventID string
+	if packet := client.NewPanicPacket(rval, raven.Transaction(method), h); packet != nil {
+		eventID, _ = client.Capture(packet, nil)
+	}
+	return panicError(eventID)
+}
+
+// panicError returns the error of a call whose handler panicked, quoting the
+// ID of the reported event so it can be given to support.
+func panicError(eventID string) error {
+	if eventID == "" {
+		return status.Error(codes.Internal, "internal error")
+	}
+	return status.Errorf(codes.Internal, "internal error (event %s)", eventID)
+}
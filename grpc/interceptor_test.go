@@ -0,0 +1,121 @@
+package ravengrpc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/getsentry/raven-go/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/orders.Orders/Get"
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func incomingContext() context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"user-agent", "grpc-go/1.0",
+		"authorization", "Bearer secret-token",
+	))
+}
+
+func checkPanicPacket(t *testing.T, transport *raven.MemoryTransport, err error) {
+	if status.Code(err) != codes.Internal {
+		t.Errorf("incorrect error: got %v, want code Internal", err)
+	}
+	packet := transport.LastEvent()
+	if packet == nil {
+		t.Fatal("panic was not reported")
+	}
+	if packet.Message != "order not found" {
+		t.Errorf("incorrect Message: got %s", packet.Message)
+	}
+	if packet.Level != raven.FATAL {
+		t.Errorf("incorrect Level: got %s, want %s", packet.Level, raven.FATAL)
+	}
+	if packet.Transaction != testMethod {
+		t.Errorf("incorrect Transaction: got %s, want %s", packet.Transaction, testMethod)
+	}
+	if !strings.Contains(err.Error(), packet.EventID) {
+		t.Errorf("error %q does not quote the event ID %s", err, packet.EventID)
+	}
+
+	var h *raven.Http
+	for _, inter := range packet.Interfaces {
+		if _, ok := inter.(raven.Transaction); ok {
+			t.Error("Transaction was sent as an interface")
+		}
+		if i, ok := inter.(*raven.Http); ok {
+			h = i
+		}
+	}
+	if h == nil {
+		t.Fatal("packet has no request")
+	}
+	if h.URL != testMethod {
+		t.Errorf("incorrect URL: got %s, want %s", h.URL, testMethod)
+	}
+	if got := h.Headers["user-agent"]; got != "grpc-go/1.0" {
+		t.Errorf("incorrect user-agent metadata: got %q", got)
+	}
+	if got := h.Headers["authorization"]; got != "********" {
+		t.Errorf("authorization metadata was not sanitized: got %q", got)
+	}
+}
+
+func TestUnaryServerInterceptorPanic(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	interceptor := ravengrpc.UnaryServerInterceptor(client)
+
+	resp, err := interceptor(incomingContext(), "request", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic(errors.New("order not found"))
+	})
+	client.Wait()
+
+	if resp != nil {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	checkPanicPacket(t, transport, err)
+}
+
+func TestUnaryServerInterceptorNoPanic(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	interceptor := ravengrpc.UnaryServerInterceptor(client)
+
+	handlerErr := status.Error(codes.NotFound, "order not found")
+	resp, err := interceptor(incomingContext(), "request", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "response", handlerErr
+	})
+	client.Wait()
+
+	if resp != "response" || err != handlerErr {
+		t.Errorf("incorrect result: got (%v, %v), want (response, %v)", resp, err, handlerErr)
+	}
+	if packets := transport.Packets(); len(packets) != 0 {
+		t.Errorf("unexpected packets: %v", packets)
+	}
+}
+
+func TestStreamServerInterceptorPanic(t *testing.T) {
+	client, transport := raven.NewTestClient()
+	interceptor := ravengrpc.StreamServerInterceptor(client)
+
+	stream := &testStream{ctx: incomingContext()}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: testMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+		panic(errors.New("order not found"))
+	})
+	client.Wait()
+
+	checkPanicPacket(t, transport, err)
+}
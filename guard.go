@@ -0,0 +1,74 @@
+package raven
+
+import "time"
+
+// How long a guard waits for the events captured so far to be sent before
+// letting a panic crash the process, so that an unreachable Sentry server only
+// delays the crash.
+const guardFlushTimeout = 5 * time.Second
+
+// Guard calls f and, if it panics, reports the panic and waits for it and every
+// other event captured so far to be sent, for up to 5 seconds, before letting
+// the panic continue and crash the process. It guards a whole program from its
+// main function:
+//
+//	func main() {
+//		raven.Guard(run)
+//	}
+//
+// Unlike CapturePanicAndRepanic, it also waits for the events captured before
+// the panic, which would otherwise be lost with the process.
+func (client *Client) Guard(f func()) {
+	defer func() {
+		if rval := recover(); rval != nil {
+			client.reportAndRepanic(rval)
+		}
+	}()
+
+	f()
+}
+
+// Guard calls f and reports a panic with the default *Client before letting
+// it continue.
+func Guard(f func()) { DefaultClient.Guard(f) }
+
+// CaptureAndRepanic is identical to Guard, except it guards the rest of the
+// function deferring it, which is usually main:
+//
+//	func main() {
+//		defer client.CaptureAndRepanic()
+//		// ...
+//	}
+//
+// It must be deferred directly, as it can't recover from the panic otherwise.
+func (client *Client) CaptureAndRepanic() {
+	if rval := recover(); rval != nil {
+		client.reportAndRepanic(rval)
+	}
+}
+
+// CaptureAndRepanic is identical to Guard, except it guards the rest of the
+// function deferring it with the default *Client:
+//
+//	func main() {
+//		defer raven.CaptureAndRepanic()
+//		// ...
+//	}
+func CaptureAndRepanic() {
+	if rval := recover(); rval != nil {
+		DefaultClient.reportAndRepanic(rval)
+	}
+}
+
+// reportAndRepanic reports a recovered panic, flushes the captured events and
+// panics again with rval. The events are flushed even if the panic itself is
+// not reported, such as when it matches SetIgnoreErrors.
+func (client *Client) reportAndRepanic(rval interface{}) {
+	if packet := client.panicPacket(rval, nil); packet != nil {
+		client.Capture(packet, nil)
+	}
+	if client.enabled() {
+		client.Flush(guardFlushTimeout)
+	}
+	panic(rval)
+}
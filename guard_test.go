@@ -0,0 +1,65 @@
+package raven
+
+import "testing"
+
+// guardedMain simulates the main function of a program guarded by guard, which
+// captures a message and then panics. It returns the packets sent by the time
+// the panic reaches the caller, and the value it panicked with.
+func guardedMain(t *testing.T, guard func(client *Client, f func())) (packets []*Packet, rval interface{}) {
+	client, _ := newRecordingClient(t)
+	transport := &slowTransport{}
+	client.Transport = transport
+
+	defer func() {
+		rval = recover()
+		packets = transport.Packets()
+	}()
+	guard(client, func() {
+		client.CaptureMessage("starting", nil)
+		panic("boom")
+	})
+	return nil, nil
+}
+
+func checkGuardedMain(t *testing.T, packets []*Packet, rval interface{}) {
+	if rval != "boom" {
+		t.Errorf("incorrect panic: got %v, want boom", rval)
+	}
+	if len(packets) != 2 {
+		t.Fatalf("events were not sent before the panic continued: got %d packets, want 2", len(packets))
+	}
+	if packets[0].Message != "starting" {
+		t.Errorf("incorrect Message of the first event: got %s, want starting", packets[0].Message)
+	}
+	if packet := packets[1]; packet.Message != "boom" || packet.Level != FATAL {
+		t.Errorf("incorrect panic event: got %s %s", packet.Level, packet.Message)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	packets, rval := guardedMain(t, func(client *Client, f func()) {
+		client.Guard(f)
+	})
+	checkGuardedMain(t, packets, rval)
+}
+
+func TestCaptureAndRepanic(t *testing.T) {
+	packets, rval := guardedMain(t, func(client *Client, f func()) {
+		defer client.CaptureAndRepanic()
+		f()
+	})
+	checkGuardedMain(t, packets, rval)
+}
+
+func TestGuardIgnoredPanic(t *testing.T) {
+	packets, rval := guardedMain(t, func(client *Client, f func()) {
+		client.SetIgnoreErrors([]string{"^boom$"})
+		client.Guard(f)
+	})
+	if rval != "boom" {
+		t.Errorf("incorrect panic: got %v, want boom", rval)
+	}
+	if len(packets) != 1 || packets[0].Message != "starting" {
+		t.Errorf("earlier events were not sent before the panic continued: got %d packets", len(packets))
+	}
+}
@@ -1,57 +1,563 @@
 package raven
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"runtime/debug"
 	"strings"
+	"sync"
 )
 
-func NewHttp(req *http.Request) *Http {
+// NewHttp builds an Http interface from req, sanitizing it with the default
+// *Client's sanitize fields.
+func NewHttp(req *http.Request) *Http { return DefaultClient.NewHttp(req) }
+
+// NewHttp builds an Http interface from req, sanitizing the query string and
+// headers with the fields set by SetSanitizeFields, or the global fields when
+// none have been set. A nil client uses the global fields and the default
+// settings.
+func (client *Client) NewHttp(req *http.Request) *Http {
+	fields := client.secretFields()
+	var trustProxy, parseCookies, preserveQuery, captureBody bool
+	var maxBodyBytes int
+	if client != nil {
+		client.mu.RLock()
+		trustProxy, parseCookies = client.trustProxyHeaders, client.parseCookies
+		preserveQuery = client.preserveQuery
+		captureBody, maxBodyBytes = client.captureRequestBody, client.maxRequestBodyBytes
+		client.mu.RUnlock()
+	}
+
 	proto := "http"
 	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
 		proto = "https"
 	}
+	valueRegexps := globalSanitizeValueRegexps()
 	h := &Http{
 		Method:  req.Method,
-		Cookies: req.Header.Get("Cookie"),
-		Query:   url.Values(sanitizeValues(req.URL.Query())).Encode(),
-		URL:     proto + "://" + req.Host + req.URL.Path,
+		Cookies: sanitizeValue(req.Header.Get("Cookie"), valueRegexps),
+		URL:     sanitizeValue(proto+"://"+requestHost(req, trustProxy)+req.URL.Path, valueRegexps),
 		Headers: make(map[string]string, len(req.Header)),
 	}
-	if addr, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		h.Env = map[string]string{"REMOTE_ADDR": addr, "REMOTE_PORT": port}
+	if preserveQuery {
+		h.Query = sanitizeRawQuery(req.URL.RawQuery, fields, valueRegexps)
+	} else {
+		h.Query = url.Values(sanitizeValuesWith(req.URL.Query(), fields)).Encode()
+	}
+	if addr, port, ok := clientAddr(req, trustProxy); ok {
+		h.Env = map[string]string{"REMOTE_ADDR": addr}
+		if port != "" {
+			h.Env["REMOTE_PORT"] = port
+		}
 	}
 
-	for k, v := range http.Header(sanitizeValues(req.Header)) {
+	// Copy the headers before sanitizing so the request itself is left intact
+	header := make(map[string][]string, len(req.Header))
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	for k, v := range http.Header(sanitizeValuesWith(header, fields)) {
 		h.Headers[k] = strings.Join(v, ",")
 	}
+
+	if parseCookies {
+		h.CookieMap, h.Cookies = sanitizeCookies(req.Cookies(), fields, valueRegexps)
+		if h.Cookies != "" {
+			h.Headers["Cookie"] = h.Cookies
+		}
+	}
+
+	if captureBody {
+		if maxBodyBytes <= 0 {
+			maxBodyBytes = defaultMaxRequestBodyBytes
+		}
+		h.Data = requestData(req, maxBodyBytes, fields)
+	}
 	return h
 }
 
-var querySecretFields = []string{"password", "passphrase", "passwd", "secret"}
+// sanitizeCookies returns cookies as a map and as a Cookie header value, with
+// the value of any cookie whose name matches fields redacted, and the parts of
+// other values matching valueRegexps.
+func sanitizeCookies(cookies []*http.Cookie, fields []string, valueRegexps []*regexp.Regexp) (map[string]string, string) {
+	if len(cookies) == 0 {
+		return nil, ""
+	}
+	cookieMap := make(map[string]string, len(cookies))
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		value := cookie.Value
+		if isSecretField(cookie.Name, fields) {
+			value = "********"
+		} else {
+			value = sanitizeValue(value, valueRegexps)
+		}
+		cookieMap[cookie.Name] = value
+		pairs = append(pairs, cookie.Name+"="+value)
+	}
+	return cookieMap, strings.Join(pairs, "; ")
+}
+
+// The number of request body bytes read when body capture is enabled and
+// SetMaxRequestBodyBytes has not been called.
+const defaultMaxRequestBodyBytes = 10 * 1024
+
+// requestData reads up to max bytes of the request body and parses it
+// according to its content type. Form bodies are returned as a
+// map[string]string and JSON objects as a map[string]interface{}, both
+// sanitized with fields. Other content types, bodies without any value and
+// the bodies of methods that don't have one, such as GET, are not captured.
+// req.Body is replaced so the handler can still read the entire body.
+func requestData(req *http.Request, max int, fields []string) interface{} {
+	if req.Body == nil || !methodHasBody(req.Method) {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(max)+1))
+	req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+	truncated := len(body) > max
+	if truncated {
+		body = body[:max]
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, _ := url.ParseQuery(string(body))
+		if len(values) == 0 {
+			return nil
+		}
+		return flattenValues(sanitizeValuesWith(values, fields))
+	case "multipart/form-data":
+		values := make(map[string][]string)
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			// Skip uploaded files, only form values are captured
+			if part.FileName() == "" {
+				value, _ := ioutil.ReadAll(part)
+				values[part.FormName()] = append(values[part.FormName()], string(value))
+			}
+			part.Close()
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return flattenValues(sanitizeValuesWith(values, fields))
+	case "application/json":
+		// A truncated JSON body cannot be parsed
+		if truncated {
+			return nil
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err != nil || len(data) == 0 {
+			return nil
+		}
+		return sanitizeData(data, fields)
+	}
+	return nil
+}
+
+// methodHasBody reports whether requests with method may have a body worth
+// capturing. The body of a GET, HEAD, OPTIONS or TRACE request has no meaning,
+// so it is left unread however long it is.
+func methodHasBody(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+	return true
+}
+
+func flattenValues(values map[string][]string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(values))
+	for k, v := range values {
+		flat[k] = strings.Join(v, ",")
+	}
+	return flat
+}
+
+// sanitizeData redacts the value of any map key matching fields, at any depth
+// of nested maps and slices as produced by encoding/json.
+func sanitizeData(data interface{}, fields []string) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for k, v := range data {
+			if isSecretField(k, fields) {
+				data[k] = "********"
+			} else {
+				data[k] = sanitizeData(v, fields)
+			}
+		}
+	case []interface{}:
+		for i, v := range data {
+			data[i] = sanitizeData(v, fields)
+		}
+	}
+	return data
+}
+
+// sanitizeExtra redacts the values of the extra data whose keys match fields,
+// at any depth of nested maps and slices, along with the parts of strings
+// matching the regexps added by AddSanitizeValueRegexp. Nested values are
+// copied rather than modified, as they may be shared with the caller.
+func (packet *Packet) sanitizeExtra(fields []string) {
+	valueRegexps := globalSanitizeValueRegexps()
+	for k, v := range packet.Extra {
+		if isSecretField(k, fields) {
+			packet.Extra[k] = "********"
+		} else {
+			packet.Extra[k] = sanitizeExtraValue(v, fields, valueRegexps)
+		}
+	}
+}
+
+func sanitizeExtraValue(value interface{}, fields []string, valueRegexps []*regexp.Regexp) interface{} {
+	switch value := value.(type) {
+	case string:
+		return sanitizeValue(value, valueRegexps)
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			if isSecretField(k, fields) {
+				sanitized[k] = "********"
+			} else {
+				sanitized[k] = sanitizeExtraValue(v, fields, valueRegexps)
+			}
+		}
+		return sanitized
+	case map[string]string:
+		sanitized := make(map[string]string, len(value))
+		for k, v := range value {
+			if isSecretField(k, fields) {
+				sanitized[k] = "********"
+			} else {
+				sanitized[k] = sanitizeValue(v, valueRegexps)
+			}
+		}
+		return sanitized
+	case []interface{}:
+		sanitized := make([]interface{}, len(value))
+		for i, v := range value {
+			sanitized[i] = sanitizeExtraValue(v, fields, valueRegexps)
+		}
+		return sanitized
+	}
+	return value
+}
+
+// isSecretField reports whether field contains one of fields, compared
+// case-insensitively, or matches one of the regexps added by
+// AddSanitizeFieldRegexp.
+func isSecretField(field string, fields []string) bool {
+	for _, re := range globalSanitizeRegexps() {
+		if re.MatchString(field) {
+			return true
+		}
+	}
+	field = strings.ToLower(field)
+	for _, keyword := range fields {
+		if strings.Contains(field, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultQuerySecretFields = []string{"password", "passphrase", "passwd", "secret", "authorization"}
+
+var querySecretFieldsLock sync.RWMutex
+var querySecretFields = append([]string(nil), defaultQuerySecretFields...)
+var querySecretRegexps []*regexp.Regexp
+var secretValueRegexps []*regexp.Regexp
+
+// globalSanitizeValueRegexps returns the regexps added by
+// AddSanitizeValueRegexp, which may be read after the lock is released.
+func globalSanitizeValueRegexps() []*regexp.Regexp {
+	querySecretFieldsLock.RLock()
+	defer querySecretFieldsLock.RUnlock()
+	return secretValueRegexps
+}
+
+// globalSanitizeRegexps returns the regexps added by AddSanitizeFieldRegexp.
+// The slice is never modified in place, so it may be read after the lock is
+// released.
+func globalSanitizeRegexps() []*regexp.Regexp {
+	querySecretFieldsLock.RLock()
+	defer querySecretFieldsLock.RUnlock()
+	return querySecretRegexps
+}
+
+// globalSanitizeFields returns the current global sanitize fields. The slice
+// is never modified in place, so it may be read after the lock is released.
+func globalSanitizeFields() []string {
+	querySecretFieldsLock.RLock()
+	defer querySecretFieldsLock.RUnlock()
+	return querySecretFields
+}
+
+// SanitizeValues returns a copy of values with the values of multiple entries
+// joined by commas, sanitized as NewHttp does for request headers. It can be
+// used to report header-like data from other protocols.
+func (client *Client) SanitizeValues(values map[string][]string) map[string]string {
+	copied := make(map[string][]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	sanitized := make(map[string]string, len(copied))
+	for k, v := range sanitizeValuesWith(copied, client.secretFields()) {
+		sanitized[k] = strings.Join(v, ",")
+	}
+	return sanitized
+}
 
 func sanitizeValues(query map[string][]string) map[string][]string {
-	for _, keyword := range querySecretFields {
-		for field := range query {
-			if strings.Contains(strings.ToLower(field), strings.ToLower(keyword)) {
-				query[field] = []string{"********"}
+	return sanitizeValuesWith(query, globalSanitizeFields())
+}
+
+func sanitizeValuesWith(query map[string][]string, fields []string) map[string][]string {
+	valueRegexps := globalSanitizeValueRegexps()
+	for field, values := range query {
+		if isSecretField(field, fields) {
+			query[field] = []string{"********"}
+			continue
+		}
+		if len(valueRegexps) > 0 {
+			sanitized := make([]string, len(values))
+			for i, value := range values {
+				sanitized[i] = sanitizeValue(value, valueRegexps)
 			}
+			query[field] = sanitized
 		}
 	}
 	return query
 }
 
+// sanitizeRawQuery sanitizes a raw query string like sanitizeValuesWith,
+// leaving its pairs in their original order and encoding. Only the values that
+// are redacted are rewritten.
+func sanitizeRawQuery(query string, fields []string, valueRegexps []*regexp.Regexp) string {
+	if query == "" {
+		return ""
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, value := pair, ""
+		idx := strings.Index(pair, "=")
+		if idx != -1 {
+			key, value = pair[:idx], pair[idx+1:]
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if isSecretField(name, fields) {
+			pairs[i] = key + "=********"
+			continue
+		}
+		if idx == -1 || len(valueRegexps) == 0 {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			if sanitized := sanitizeValue(unescaped, valueRegexps); sanitized != unescaped {
+				pairs[i] = key + "=" + url.QueryEscape(sanitized)
+			}
+		} else {
+			pairs[i] = key + "=" + sanitizeValue(value, valueRegexps)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sanitizeValue redacts the parts of value matching any of regexps.
+func sanitizeValue(value string, regexps []*regexp.Regexp) string {
+	for _, re := range regexps {
+		value = re.ReplaceAllLiteralString(value, "********")
+	}
+	return value
+}
+
 // AddSanitizewField adds a custom sanitize field to the array of fields to
 // search for and sanitize. This allows you to hide sensitive information in
-// both the query string and headers.
+// both the query string and headers. It is safe to call concurrently with
+// NewHttp.
 func AddSanitizeField(field string) {
+	querySecretFieldsLock.Lock()
+	defer querySecretFieldsLock.Unlock()
 	querySecretFields = append(querySecretFields, field)
 }
 
+// AddSanitizeFieldRegexp adds a regular expression matching the names of
+// fields to sanitize, along with the fields added by AddSanitizeField. Unlike
+// those, which are sanitized whenever a name contains them, it can match names
+// exactly, such as with `(?i)^(password|api[_-]?key)$`. Names are matched as
+// they are, so header names are canonicalized such as "Api-Key". It applies to
+// every client, including those with their own fields set by
+// SetSanitizeFields.
+func AddSanitizeFieldRegexp(re *regexp.Regexp) {
+	querySecretFieldsLock.Lock()
+	defer querySecretFieldsLock.Unlock()
+	querySecretRegexps = append(querySecretRegexps, re)
+}
+
+// AddSanitizeValueRegexp adds a regular expression matching secrets to redact
+// wherever they appear in the URL, query string values and header values of
+// requests, whatever the name of the field holding them, such as
+// `Bearer [\w.-]+` for bearer tokens or `\b\d{13,16}\b` for card numbers.
+// No values are redacted by pattern by default.
+func AddSanitizeValueRegexp(re *regexp.Regexp) {
+	querySecretFieldsLock.Lock()
+	defer querySecretFieldsLock.Unlock()
+	secretValueRegexps = append(secretValueRegexps, re)
+}
+
+// RemoveSanitizeField removes every occurrence of field, compared
+// case-insensitively, from the array of fields to search for and sanitize,
+// including the defaults.
+func RemoveSanitizeField(field string) {
+	querySecretFieldsLock.Lock()
+	defer querySecretFieldsLock.Unlock()
+	var fields []string
+	for _, f := range querySecretFields {
+		if !strings.EqualFold(f, field) {
+			fields = append(fields, f)
+		}
+	}
+	querySecretFields = fields
+}
+
+// ResetSanitizeFields restores the array of fields to search for and sanitize
+// to the defaults, discarding anything added by AddSanitizeField,
+// AddSanitizeFieldRegexp or AddSanitizeValueRegexp.
+func ResetSanitizeFields() {
+	querySecretFieldsLock.Lock()
+	defer querySecretFieldsLock.Unlock()
+	querySecretFields = append([]string(nil), defaultQuerySecretFields...)
+	querySecretRegexps = nil
+	secretValueRegexps = nil
+}
+
+// SetSanitizeFields sets the fields this client searches for and sanitizes in
+// place of the global fields managed by AddSanitizeField. Passing nil reverts
+// to the global fields.
+func (client *Client) SetSanitizeFields(fields []string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if fields == nil {
+		client.sanitizeFields = nil
+		return
+	}
+	client.sanitizeFields = append([]string{}, fields...)
+}
+
+// SetSanitizeExtra sets whether the extra data of packets is sanitized with the
+// same fields as requests when they are sent, which it is by default.
+func (client *Client) SetSanitizeExtra(sanitize bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.disableSanitizeExtra = !sanitize
+}
+
+// SetParseCookies sets whether NewHttp parses the Cookie header into
+// Http.CookieMap, redacting cookies whose names match the sanitize fields. The
+// Cookies string and Cookie header are rebuilt from the redacted cookies.
+func (client *Client) SetParseCookies(parse bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.parseCookies = parse
+}
+
+// SetCaptureRequestBody sets whether NewHttp reads the request body into
+// Http.Data. Form values and JSON objects are captured and sanitized; other
+// content types, and the bodies of GET, HEAD, OPTIONS and TRACE requests, are
+// ignored. At most SetMaxRequestBodyBytes bytes are read, and the request body
+// remains readable by the handler.
+func (client *Client) SetCaptureRequestBody(capture bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.captureRequestBody = capture
+}
+
+// SetMaxRequestBodyBytes sets the number of request body bytes read when body
+// capture is enabled. A value of zero or less restores the default of 10KB.
+func (client *Client) SetMaxRequestBodyBytes(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.maxRequestBodyBytes = n
+}
+
+// SetTrustProxyHeaders sets whether NewHttp takes the client address and the
+// requested host from the Forwarded, X-Forwarded-For and X-Forwarded-Host
+// headers set by a reverse proxy. These headers
+// can be spoofed by clients, so only enable this behind a proxy that sets or
+// strips them.
+func (client *Client) SetTrustProxyHeaders(trust bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.trustProxyHeaders = trust
+}
+
+// SetPreserveQuery sets whether NewHttp keeps the query string as it was sent,
+// with its original order and repeated keys. By default it is decoded and
+// encoded again, sorted by key. Either way, the values of secret fields and
+// the parts of values matching AddSanitizeValueRegexp are redacted.
+func (client *Client) SetPreserveQuery(preserve bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.preserveQuery = preserve
+}
+
+// SetSanitizeExtra sets whether the default *Client sanitizes extra data
+func SetSanitizeExtra(sanitize bool) { DefaultClient.SetSanitizeExtra(sanitize) }
+
+// SetCaptureRequestBody sets whether the default *Client captures request bodies
+func SetCaptureRequestBody(capture bool) { DefaultClient.SetCaptureRequestBody(capture) }
+
+// SetMaxRequestBodyBytes sets the request body capture limit of the default *Client
+func SetMaxRequestBodyBytes(n int) { DefaultClient.SetMaxRequestBodyBytes(n) }
+
+// SetParseCookies sets whether the default *Client parses cookies into a map
+func SetParseCookies(parse bool) { DefaultClient.SetParseCookies(parse) }
+
+// SetTrustProxyHeaders sets whether the default *Client trusts proxy headers
+func SetTrustProxyHeaders(trust bool) { DefaultClient.SetTrustProxyHeaders(trust) }
+
+// SetPreserveQuery sets whether the default *Client keeps raw query strings
+func SetPreserveQuery(preserve bool) { DefaultClient.SetPreserveQuery(preserve) }
+
+func (client *Client) secretFields() []string {
+	if client != nil {
+		client.mu.RLock()
+		fields := client.sanitizeFields
+		client.mu.RUnlock()
+		if fields != nil {
+			return fields
+		}
+	}
+	return globalSanitizeFields()
+}
+
 // https://docs.getsentry.com/hosted/clientdev/interfaces/#context-interfaces
 type Http struct {
 	// Required
@@ -64,56 +570,251 @@ type Http struct {
 	Headers map[string]string `json:"headers,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
 
-	// Must be either a string or map[string]string
+	// Must be either a string, a map[string]string such as the form values
+	// captured by NewHttp, or a map[string]interface{} such as a JSON object
+	// it captured, holding values as decoded by encoding/json
 	Data interface{} `json:"data,omitempty"`
+
+	// When set, serialized as "cookies" in place of the Cookies string
+	CookieMap map[string]string `json:"-"`
 }
 
 func (h *Http) Class() string { return "request" }
 
+func (h *Http) isEmpty() bool {
+	return h.URL == "" && h.Method == "" && h.Query == "" && h.Cookies == "" && len(h.Headers) == 0 &&
+		len(h.Env) == 0 && h.Data == nil && len(h.CookieMap) == 0
+}
+
+func (h *Http) MarshalJSON() ([]byte, error) {
+	type httpAlias Http
+	if h.CookieMap == nil {
+		return json.Marshal((*httpAlias)(h))
+	}
+	return json.Marshal(struct {
+		*httpAlias
+		Cookies map[string]string `json:"cookies,omitempty"`
+	}{(*httpAlias)(h), h.CookieMap})
+}
+
+// CaptureRequestError formats and delivers an error that occurred while
+// serving req to the Sentry server, along with the request. Adds a stacktrace
+// to the packet, excluding the call to this method.
+func (client *Client) CaptureRequestError(err error, req *http.Request, tags map[string]string) string {
+	return client.captureRequestError(err, req, tags, 1)
+}
+
+// CaptureRequestError formats and delivers an error that occurred while
+// serving req to the Sentry server using the default *Client.
+// Adds a stacktrace to the packet, excluding the call to this method.
+func CaptureRequestError(err error, req *http.Request, tags map[string]string) string {
+	return DefaultClient.captureRequestError(err, req, tags, 1)
+}
+
+// captureRequestError captures err with a stacktrace starting skip frames
+// above its caller.
+func (client *Client) captureRequestError(err error, req *http.Request, tags map[string]string, skip int) string {
+	if !client.enabled() || client.shouldExcludeErr(err.Error()) {
+		return ""
+	}
+
+	packet := NewPacket(err.Error(), append(client.context.interfaces(), NewExceptions(err, client.errorStacktrace(err, skip+1)), client.NewHttp(req))...)
+	client.addRouteTag(packet, req)
+	eventID, _ := client.Capture(packet, tags)
+
+	return eventID
+}
+
+// requestPanicPacket builds the packet reported for a panic recovered while
+// serving req, or returns nil if it should not be reported.
+func (client *Client) requestPanicPacket(rval interface{}, req *http.Request) *Packet {
+	packet := client.panicPacket(rval, []Interface{client.NewHttp(req)})
+	if packet != nil {
+		client.addRouteTag(packet, req)
+	}
+	return packet
+}
+
+// SetRouteFunc sets a function returning the route pattern matched by a
+// request, such as "/users/{id}", which is added as the route tag of the events
+// reported by the handlers and middlewares of this package and by
+// CaptureRequestError. Events are grouped and filtered better by route than by
+// path. How the pattern is found depends on the router, such as with
+// gorilla/mux:
+//
+//	raven.SetRouteFunc(func(r *http.Request) string {
+//		template, _ := mux.CurrentRoute(r).GetPathTemplate()
+//		return template
+//	})
+//
+// No tag is added when it returns an empty pattern, or when the function is
+// nil, which it is by default.
+func (client *Client) SetRouteFunc(route func(*http.Request) string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.routeFunc = route
+}
+
+// SetRouteFunc sets the function returning the route of a request for the default *Client
+func SetRouteFunc(route func(*http.Request) string) { DefaultClient.SetRouteFunc(route) }
+
+// addRouteTag tags the packet with the route of req, if it has one.
+func (client *Client) addRouteTag(packet *Packet, req *http.Request) {
+	client.mu.RLock()
+	routeFunc := client.routeFunc
+	client.mu.RUnlock()
+
+	if routeFunc == nil {
+		return
+	}
+	if route := routeFunc(req); route != "" {
+		packet.AddTags(map[string]string{"route": route})
+	}
+}
+
 // Recovery handler to wrap the stdlib net/http Mux. This function will detect a
 // panic, report it, and recover from the panic, preventing it from continuing
-// further.
+// further. A 500 status and an X-Sentry-ID header holding the ID of the
+// reported event are written unless the handler already wrote a response.
 //
 // Example:
-//	http.HandleFunc("/", raven.ReportHandler(func(w http.ResponseWriter, r *http.Request) {
+//
+//	http.HandleFunc("/", raven.RecoveryHandler(func(w http.ResponseWriter, r *http.Request) {
 //		...
 //	}))
 func RecoveryHandler(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return RecoveryHandlerWithTags(handler, nil)
+}
+
+// RecoveryHandlerWithTags is identical to RecoveryHandler, except the packet
+// of a reported panic is tagged with the result of calling tags with the
+// request, such as a request ID taken from its context.
+//
+// The tags are passed to Capture, so on a key collision, tags set on the
+// packet itself take precedence, followed by these tags and the client's tags.
+//
+// Example:
+//
+//	http.HandleFunc("/", raven.RecoveryHandlerWithTags(handler, func(r *http.Request) map[string]string {
+//		return map[string]string{"request_id": r.Header.Get("X-Request-ID")}
+//	}))
+func RecoveryHandlerWithTags(handler func(http.ResponseWriter, *http.Request), tags func(*http.Request) map[string]string) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
 		defer func() {
 			if rval := recover(); rval != nil {
 				debug.PrintStack()
-				rvalStr := fmt.Sprint(rval)
-				packet := NewPacket(rvalStr, NewException(errors.New(rvalStr), NewStacktrace(2, 3, nil)), NewHttp(r))
-				Capture(packet, nil)
-				w.WriteHeader(http.StatusInternalServerError)
+				var eventID string
+				if packet := DefaultClient.requestPanicPacket(rval, r); packet != nil {
+					var captureTags map[string]string
+					if tags != nil {
+						captureTags = tags(r)
+					}
+					eventID, _ = Capture(packet, captureTags)
+				}
+				if !sw.wroteHeader {
+					writePanicResponse(w, eventID)
+				}
 			}
 		}()
 
-		handler(w, r)
+		handler(sw, r)
 	}
 }
 
 // Report handler to wrap the stdlib net/http Mux. This function will detect a
-// panic, report it, and allow the panic to contune.
+// panic, report it, and allow the panic to contune. A 500 status and an
+// X-Sentry-ID header holding the ID of the reported event are written unless
+// the handler already wrote a response.
 //
 // Example:
+//
 //	http.HandleFunc("/", raven.ReportHandler(func(w http.ResponseWriter, r *http.Request) {
 //		...
 //	}))
 func ReportHandler(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
 		defer func() {
 			if rval := recover(); rval != nil {
 				debug.PrintStack()
-				rvalStr := fmt.Sprint(rval)
-				packet := NewPacket(rvalStr, NewException(errors.New(rvalStr), NewStacktrace(2, 3, nil)), NewHttp(r))
-				Capture(packet, nil)
-				w.WriteHeader(http.StatusInternalServerError)
+				var eventID string
+				if packet := DefaultClient.requestPanicPacket(rval, r); packet != nil {
+					eventID, _ = Capture(packet, nil)
+				}
+				if !sw.wroteHeader {
+					writePanicResponse(w, eventID)
+				}
 				panic(rval)
 			}
 		}()
 
-		handler(w, r)
+		handler(sw, r)
+	}
+}
+
+// RecoveryMiddleware wraps an http.Handler to detect a panic, report it, and
+// recover from the panic, preventing it from continuing further. A 500 status
+// and an X-Sentry-ID header holding the ID of the reported event are written
+// unless the handler already wrote a response.
+//
+// Example:
+//
+//	http.Handle("/", raven.RecoveryMiddleware(handler))
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(RecoveryHandler(next.ServeHTTP))
+}
+
+// ReportMiddleware wraps an http.Handler to detect a panic, report it, and
+// allow the panic to continue. A 500 status and an X-Sentry-ID header holding
+// the ID of the reported event are written unless the handler already wrote a
+// response.
+//
+// Example:
+//
+//	http.Handle("/", raven.ReportMiddleware(handler))
+func ReportMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(ReportHandler(next.ServeHTTP))
+}
+
+// writePanicResponse writes a 500 status, exposing the ID of the reported
+// event in the X-Sentry-ID header so it can be quoted to support.
+func writePanicResponse(w http.ResponseWriter, eventID string) {
+	if eventID != "" {
+		w.Header().Set("X-Sentry-ID", eventID)
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// statusWriter records whether a response has been started so a panic
+// handler doesn't write a second status.
+type statusWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("raven: ResponseWriter does not implement http.Hijacker")
 	}
+	w.wroteHeader = true
+	return h.Hijack()
 }
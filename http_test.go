@@ -1,9 +1,17 @@
 package raven
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -85,12 +93,22 @@ func NewCookiesRequest() testcase {
 	return testcase{req, h}
 }
 
+func NewAuthorizationRequest() testcase {
+	req := newBaseRequest()
+	req.Header.Add("Authorization", "Bearer abc123")
+
+	h := newBaseHttp()
+	h.Headers["Authorization"] = "********"
+	return testcase{req, h}
+}
+
 var newHttpTests = []testcase{
 	NewRequest(),
 	NewRequestIPV6(),
 	NewRequestMultipleHeaders(),
 	NewSecureRequest(),
 	NewCookiesRequest(),
+	NewAuthorizationRequest(),
 }
 
 func TestNewHttp(t *testing.T) {
@@ -175,3 +193,686 @@ func TestSanitizeHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestNewHttpNilClient(t *testing.T) {
+	req := newBaseRequest()
+	req.URL.RawQuery = "password=hunter2"
+
+	var client *Client
+	h := client.NewHttp(req)
+	if h.URL != "http://example.com/" || h.Query != "password=%2A%2A%2A%2A%2A%2A%2A%2A" {
+		t.Errorf("incorrect request of a nil client: got %s?%s", h.URL, h.Query)
+	}
+}
+
+func TestNewHttpLeavesRequestHeaders(t *testing.T) {
+	req := newBaseRequest()
+	req.Header.Add("Authorization", "Bearer abc123")
+
+	NewHttp(req)
+	if actual := req.Header.Get("Authorization"); actual != "Bearer abc123" {
+		t.Errorf("request header was modified: got %s, want %s", actual, "Bearer abc123")
+	}
+}
+
+func TestSanitizeFieldsConcurrent(t *testing.T) {
+	const goroutines = 8
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			AddSanitizeField("x-raven-concurrent-test")
+		}
+		close(done)
+	}()
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					NewHttp(newBaseRequest())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRemoveSanitizeField(t *testing.T) {
+	defer ResetSanitizeFields()
+
+	AddSanitizeField("token")
+	AddSanitizeField("token")
+	RemoveSanitizeField("token")
+	RemoveSanitizeField("Secret")
+
+	actual := url.Values(sanitizeValues(parseQuery("token=foo&secret_santa_id=bar&password=baz")))
+	expected := parseQuery("token=foo&secret_santa_id=bar&password=********")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("incorrect sanitization: got %+v, want %+v", actual, expected)
+	}
+}
+
+func TestResetSanitizeFields(t *testing.T) {
+	AddSanitizeField("token")
+	RemoveSanitizeField("password")
+	ResetSanitizeFields()
+
+	actual := url.Values(sanitizeValues(parseQuery("token=foo&password=bar")))
+	expected := parseQuery("token=foo&password=********")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("incorrect sanitization: got %+v, want %+v", actual, expected)
+	}
+}
+
+func TestSanitizeFieldRegexp(t *testing.T) {
+	defer ResetSanitizeFields()
+
+	RemoveSanitizeField("secret")
+	AddSanitizeFieldRegexp(regexp.MustCompile(`(?i)^(password|api[_-]?key|secret)$`))
+
+	actual := url.Values(sanitizeValues(parseQuery("not_a_secret_flag=1&api-key=foo&API_KEY=bar&secret=baz&apikeys=qux")))
+	expected := parseQuery("not_a_secret_flag=1&api-key=********&API_KEY=********&secret=********&apikeys=qux")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("incorrect sanitization: got %+v, want %+v", actual, expected)
+	}
+
+	req := newBaseRequest()
+	req.Header.Set("Api-Key", "foo")
+	if h := NewHttp(req); h.Headers["Api-Key"] != "********" {
+		t.Errorf("incorrect Api-Key header: got %s", h.Headers["Api-Key"])
+	}
+
+	ResetSanitizeFields()
+	actual = url.Values(sanitizeValues(parseQuery("not_a_secret_flag=1&api-key=foo")))
+	expected = parseQuery("not_a_secret_flag=********&api-key=foo")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("incorrect sanitization after ResetSanitizeFields: got %+v, want %+v", actual, expected)
+	}
+}
+
+func TestSanitizeValueRegexp(t *testing.T) {
+	defer ResetSanitizeFields()
+
+	req := newBaseRequest()
+	req.URL.Path = "/reset/tok_abc123"
+	req.URL.RawQuery = "next=%2Fhome%3Ftoken%3Dtok_def456&page=2"
+	req.Header.Set("X-Forwarded-Auth", "Bearer tok_ghi789")
+
+	// Values are only redacted by pattern once it is enabled
+	if h := NewHttp(req); !strings.Contains(h.URL, "tok_abc123") {
+		t.Errorf("URL redacted by default: got %s", h.URL)
+	}
+
+	AddSanitizeValueRegexp(regexp.MustCompile(`tok_[0-9a-z]+`))
+	h := NewHttp(req)
+	if h.URL != "http://example.com/reset/********" {
+		t.Errorf("incorrect URL: got %s", h.URL)
+	}
+	query, _ := url.ParseQuery(h.Query)
+	if actual := query.Get("next"); actual != "/home?token=********" {
+		t.Errorf("incorrect next query value: got %s", actual)
+	}
+	if actual := query.Get("page"); actual != "2" {
+		t.Errorf("incorrect page query value: got %s", actual)
+	}
+	if actual := h.Headers["X-Forwarded-Auth"]; actual != "Bearer ********" {
+		t.Errorf("incorrect X-Forwarded-Auth header: got %s", actual)
+	}
+	if actual := req.Header.Get("X-Forwarded-Auth"); actual != "Bearer tok_ghi789" {
+		t.Errorf("request header was modified: got %s", actual)
+	}
+}
+
+func TestSanitizeValueRegexpParsedCookies(t *testing.T) {
+	defer ResetSanitizeFields()
+	AddSanitizeValueRegexp(regexp.MustCompile(`tok_[0-9a-z]+`))
+
+	client := &Client{}
+	client.SetParseCookies(true)
+	req := newBaseRequest()
+	req.Header.Add("Cookie", "sid=tok_abc123; theme=dark")
+
+	h := client.NewHttp(req)
+	if expected := map[string]string{"sid": "********", "theme": "dark"}; !reflect.DeepEqual(h.CookieMap, expected) {
+		t.Errorf("incorrect CookieMap: got %+v, want %+v", h.CookieMap, expected)
+	}
+	if expected := "sid=********; theme=dark"; h.Cookies != expected || h.Headers["Cookie"] != expected {
+		t.Errorf("incorrect Cookies: got %s and header %s, want %s", h.Cookies, h.Headers["Cookie"], expected)
+	}
+}
+
+func TestSanitizeValues(t *testing.T) {
+	values := map[string][]string{
+		"authorization": {"Bearer secret-token"},
+		"accept":        {"text/plain", "text/html"},
+	}
+	sanitized := (&Client{}).SanitizeValues(values)
+	if actual := sanitized["authorization"]; actual != "********" {
+		t.Errorf("incorrect authorization value: got %s", actual)
+	}
+	if actual := sanitized["accept"]; actual != "text/plain,text/html" {
+		t.Errorf("incorrect accept value: got %s", actual)
+	}
+	if actual := values["authorization"][0]; actual != "Bearer secret-token" {
+		t.Errorf("values were modified: got %s", actual)
+	}
+}
+
+func TestSanitizeExtra(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	nested := map[string]interface{}{
+		"user":  "alice",
+		"creds": []interface{}{map[string]interface{}{"api_secret": "s3cr3t", "region": "eu"}},
+		"env":   map[string]string{"DB_PASSWORD": "hunter2", "HOME": "/root"},
+	}
+	packet := NewPacket("boom")
+	packet.Extra["db_password"] = "hunter2"
+	packet.Extra["config"] = nested
+	client.Capture(packet, nil)
+	client.Wait()
+
+	extra := transport.Packets()[0].Extra
+	if actual := extra["db_password"]; actual != "********" {
+		t.Errorf("db_password was not redacted: got %v", actual)
+	}
+	config := extra["config"].(map[string]interface{})
+	if actual := config["user"]; actual != "alice" {
+		t.Errorf("incorrect user: got %v", actual)
+	}
+	creds := config["creds"].([]interface{})[0].(map[string]interface{})
+	if actual := creds["api_secret"]; actual != "********" {
+		t.Errorf("nested api_secret was not redacted: got %v", actual)
+	}
+	if actual := creds["region"]; actual != "eu" {
+		t.Errorf("incorrect nested region: got %v", actual)
+	}
+	env := config["env"].(map[string]string)
+	if env["DB_PASSWORD"] != "********" || env["HOME"] != "/root" {
+		t.Errorf("incorrect nested env: got %v", env)
+	}
+	if actual := nested["creds"].([]interface{})[0].(map[string]interface{})["api_secret"]; actual != "s3cr3t" {
+		t.Errorf("the caller's extra data was modified: got %v", actual)
+	}
+
+	client.SetSanitizeExtra(false)
+	packet = NewPacket("boom")
+	packet.Extra["db_password"] = "hunter2"
+	client.Capture(packet, nil)
+	client.Wait()
+	if actual := transport.Packets()[1].Extra["db_password"]; actual != "hunter2" {
+		t.Errorf("extra data was sanitized when disabled: got %v", actual)
+	}
+}
+
+func TestClientSanitizeFields(t *testing.T) {
+	client := &Client{}
+	client.SetSanitizeFields([]string{"token"})
+
+	req := newBaseRequest()
+	req.URL.RawQuery = "token=foo&password=bar"
+
+	actual := client.NewHttp(req)
+	if expected := "password=bar&token=%2A%2A%2A%2A%2A%2A%2A%2A"; actual.Query != expected {
+		t.Errorf("incorrect Query: got %s, want %s", actual.Query, expected)
+	}
+
+	client.SetSanitizeFields(nil)
+	actual = client.NewHttp(req)
+	if expected := "password=%2A%2A%2A%2A%2A%2A%2A%2A&token=foo"; actual.Query != expected {
+		t.Errorf("incorrect Query: got %s, want %s", actual.Query, expected)
+	}
+}
+
+var requestBodyTests = []struct {
+	contentType string
+	body        string
+	data        interface{}
+}{
+	{
+		"application/x-www-form-urlencoded",
+		"foo=bar&foo=baz&password=hunter2",
+		map[string]string{"foo": "bar,baz", "password": "********"},
+	},
+	{
+		"multipart/form-data; boundary=xyz",
+		"--xyz\r\nContent-Disposition: form-data; name=\"foo\"\r\n\r\nbar\r\n" +
+			"--xyz\r\nContent-Disposition: form-data; name=\"passwd\"\r\n\r\nhunter2\r\n" +
+			"--xyz\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\ncontents\r\n" +
+			"--xyz--\r\n",
+		map[string]string{"foo": "bar", "passwd": "********"},
+	},
+	{
+		"application/json",
+		`{"foo":"bar","secret":{"a":1}}`,
+		map[string]interface{}{"foo": "bar", "secret": "********"},
+	},
+	{"text/plain", "password=hunter2", nil},
+}
+
+func TestNewHttpRequestBody(t *testing.T) {
+	client := &Client{}
+	client.SetCaptureRequestBody(true)
+
+	for _, test := range requestBodyTests {
+		req := newBaseRequest()
+		req.Method = "POST"
+		req.Header.Set("Content-Type", test.contentType)
+		req.Body = ioutil.NopCloser(strings.NewReader(test.body))
+
+		actual := client.NewHttp(req)
+		if !reflect.DeepEqual(actual.Data, test.data) {
+			t.Errorf("incorrect Data for %s: got %#v, want %#v", test.contentType, actual.Data, test.data)
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != test.body {
+			t.Errorf("request body was not restored: got %q, want %q", body, test.body)
+		}
+	}
+}
+
+func TestNewHttpRequestBodyLimit(t *testing.T) {
+	client := &Client{}
+	client.SetCaptureRequestBody(true)
+	client.SetMaxRequestBodyBytes(7)
+
+	original := "foo=bar&baz=qux"
+	req := newBaseRequest()
+	req.Method = "POST"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Body = ioutil.NopCloser(strings.NewReader(original))
+
+	actual := client.NewHttp(req)
+	if expected := map[string]string{"foo": "bar"}; !reflect.DeepEqual(actual.Data, expected) {
+		t.Errorf("incorrect Data: got %#v, want %#v", actual.Data, expected)
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != original {
+		t.Errorf("request body was not restored: got %q, want %q", body, original)
+	}
+}
+
+func TestNewHttpRequestBodyMethods(t *testing.T) {
+	client := &Client{}
+	client.SetCaptureRequestBody(true)
+
+	for _, test := range []struct {
+		method string
+		body   string
+		data   interface{}
+		read   bool
+	}{
+		{"GET", "foo=bar", nil, false},
+		{"HEAD", "foo=bar", nil, false},
+		{"OPTIONS", "foo=bar", nil, false},
+		{"POST", "foo=bar", map[string]string{"foo": "bar"}, true},
+		{"PUT", "foo=bar", map[string]string{"foo": "bar"}, true},
+		{"POST", "", nil, false},
+		{"POST", "&", nil, true},
+	} {
+		req := newBaseRequest()
+		req.Method = test.method
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		body := &countingReader{r: strings.NewReader(test.body)}
+		req.Body = ioutil.NopCloser(body)
+
+		actual := client.NewHttp(req)
+		if !reflect.DeepEqual(actual.Data, test.data) {
+			t.Errorf("incorrect Data for %s %q: got %#v, want %#v", test.method, test.body, actual.Data, test.data)
+		}
+		if read := body.n > 0; read != test.read {
+			t.Errorf("incorrect reading of the body of %s %q: got %t, want %t", test.method, test.body, read, test.read)
+		}
+		if b, _ := json.Marshal(actual); test.data == nil && strings.Contains(string(b), `"data"`) {
+			t.Errorf("empty Data was sent for %s %q: got %s", test.method, test.body, b)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestSanitizeData(t *testing.T) {
+	var data interface{}
+	input := `{"user":{"profile":{"password":"hunter2","name":"bob"}},"tokens":[{"secret":42},{"id":1}],"passwd":null}`
+	if err := json.Unmarshal([]byte(input), &data); err != nil {
+		t.Fatal("unable to decode JSON:", err)
+	}
+
+	expected := map[string]interface{}{
+		"user": map[string]interface{}{
+			"profile": map[string]interface{}{"password": "********", "name": "bob"},
+		},
+		"tokens": []interface{}{
+			map[string]interface{}{"secret": "********"},
+			map[string]interface{}{"id": float64(1)},
+		},
+		"passwd": "********",
+	}
+	actual := sanitizeData(data, defaultQuerySecretFields)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("incorrect sanitization: got %#v, want %#v", actual, expected)
+	}
+}
+
+func TestNewHttpParseCookies(t *testing.T) {
+	client := &Client{}
+	client.SetParseCookies(true)
+	client.SetSanitizeFields([]string{"session"})
+
+	req := newBaseRequest()
+	req.Header.Add("Cookie", "foo=bar; session_id=abc123")
+
+	actual := client.NewHttp(req)
+	if expected := map[string]string{"foo": "bar", "session_id": "********"}; !reflect.DeepEqual(actual.CookieMap, expected) {
+		t.Errorf("incorrect CookieMap: got %+v, want %+v", actual.CookieMap, expected)
+	}
+	if expected := "foo=bar; session_id=********"; actual.Cookies != expected || actual.Headers["Cookie"] != expected {
+		t.Errorf("incorrect Cookies: got %s and header %s, want %s", actual.Cookies, actual.Headers["Cookie"], expected)
+	}
+
+	b, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatal("JSON marshalling should not fail:", err)
+	}
+	var serialized struct {
+		Cookies map[string]string `json:"cookies"`
+	}
+	if err := json.Unmarshal(b, &serialized); err != nil {
+		t.Fatal("unable to decode JSON:", err)
+	}
+	if !reflect.DeepEqual(serialized.Cookies, actual.CookieMap) {
+		t.Errorf("incorrect serialized cookies: got %+v, want %+v", serialized.Cookies, actual.CookieMap)
+	}
+}
+
+func TestNewHttpPreserveQuery(t *testing.T) {
+	req := newBaseRequest()
+	req.URL.RawQuery = "tag=b&password=hunter2&tag=a&q=go%20lang&flag"
+
+	client := &Client{}
+	if actual, expected := client.NewHttp(req).Query, "flag=&password=%2A%2A%2A%2A%2A%2A%2A%2A&q=go+lang&tag=b&tag=a"; actual != expected {
+		t.Errorf("incorrect default Query: got %s, want %s", actual, expected)
+	}
+
+	client.SetPreserveQuery(true)
+	if actual, expected := client.NewHttp(req).Query, "tag=b&password=********&tag=a&q=go%20lang&flag"; actual != expected {
+		t.Errorf("incorrect preserved Query: got %s, want %s", actual, expected)
+	}
+	if req.URL.RawQuery != "tag=b&password=hunter2&tag=a&q=go%20lang&flag" {
+		t.Errorf("request was modified: got %s", req.URL.RawQuery)
+	}
+}
+
+func TestNewHttpPreserveQueryValueRegexp(t *testing.T) {
+	defer ResetSanitizeFields()
+	AddSanitizeValueRegexp(regexp.MustCompile(`tok_[0-9a-z]+`))
+	req := newBaseRequest()
+	req.URL.RawQuery = "next=tok_abc123&page=2"
+
+	client := &Client{}
+	if actual, expected := client.NewHttp(req).Query, "next=%2A%2A%2A%2A%2A%2A%2A%2A&page=2"; actual != expected {
+		t.Errorf("incorrect default Query: got %s, want %s", actual, expected)
+	}
+
+	client.SetPreserveQuery(true)
+	if actual, expected := client.NewHttp(req).Query, "next=%2A%2A%2A%2A%2A%2A%2A%2A&page=2"; actual != expected {
+		t.Errorf("incorrect preserved Query: got %s, want %s", actual, expected)
+	}
+}
+
+func TestHttpJSON(t *testing.T) {
+	h := newBaseHttp()
+	h.Cookies = "foo=bar"
+
+	expected := `{"url":"http://example.com/","method":"GET","cookies":"foo=bar","headers":{"Foo":"bar"},"env":{"REMOTE_ADDR":"127.0.0.1","REMOTE_PORT":"8000"}}`
+	b, _ := json.Marshal(h)
+	if string(b) != expected {
+		t.Errorf("incorrect JSON: got %s, want %s", string(b), expected)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newBaseRequest())
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRecoveryMiddlewareAfterWriteHeader(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newBaseRequest())
+	if w.Code != http.StatusAccepted {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestRouteTag(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.SetRouteFunc(func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			return "/users/{id}"
+		}
+		return ""
+	})
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	withDefaultClient(client, func() {
+		req := newBaseRequest()
+		req.URL.Path = "/users/42"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		handler.ServeHTTP(httptest.NewRecorder(), newBaseRequest())
+		client.CaptureRequestError(errors.New("boom"), req, nil)
+		client.Wait()
+	})
+
+	packets := transport.Packets()
+	if len(packets) != 3 {
+		t.Fatalf("incorrect number of packets: got %d, want 3", len(packets))
+	}
+	for i, expected := range []string{"/users/{id}", "", "/users/{id}"} {
+		if actual := tagValue(packets[i].Tags, "route"); actual != expected {
+			t.Errorf("incorrect route tag of packet %d: got %q, want %q", i, actual, expected)
+		}
+	}
+}
+
+// headerCountingRecorder counts the calls to WriteHeader.
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	writeHeaderCalls int
+}
+
+func (w *headerCountingRecorder) WriteHeader(code int) {
+	w.writeHeaderCalls++
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestRecoveryHandlerAfterWrite(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	handler := RecoveryHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	w := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	withDefaultClient(client, func() {
+		handler(w, newBaseRequest())
+		client.Wait()
+	})
+	if w.writeHeaderCalls != 1 || w.Code != http.StatusOK {
+		t.Errorf("incorrect response: got %d calls to WriteHeader and status %d, want 1 and %d", w.writeHeaderCalls, w.Code, http.StatusOK)
+	}
+	if w.Header().Get("X-Sentry-ID") != "" {
+		t.Error("X-Sentry-ID header set after the response was written")
+	}
+	if packets := transport.Packets(); len(packets) != 1 || packets[0].Message != "boom" {
+		t.Errorf("incorrect packets: got %v", packets)
+	}
+}
+
+func TestReportMiddleware(t *testing.T) {
+	handler := ReportMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	defer func() {
+		if rval := recover(); rval != "boom" {
+			t.Errorf("incorrect panic: got %v, want %v", rval, "boom")
+		}
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	}()
+	handler.ServeHTTP(w, newBaseRequest())
+}
+
+func TestRecoveryHandlerEventID(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	handler := RecoveryHandler(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	withDefaultClient(client, func() {
+		handler(w, newBaseRequest())
+		client.Wait()
+	})
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	if actual := w.Header().Get("X-Sentry-ID"); actual != packets[0].EventID {
+		t.Errorf("incorrect X-Sentry-ID: got %s, want %s", actual, packets[0].EventID)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("incorrect status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+type testPanicError struct{}
+
+func (e *testPanicError) Error() string { return "test panic error" }
+
+func TestRecoveryHandlerErrorType(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	handler := RecoveryHandler(func(w http.ResponseWriter, r *http.Request) {
+		panic(&testPanicError{})
+	})
+
+	withDefaultClient(client, func() {
+		handler(httptest.NewRecorder(), newBaseRequest())
+		client.Wait()
+	})
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	var exception *Exception
+	for _, inter := range packets[0].Interfaces {
+		if e, ok := inter.(*Exception); ok {
+			exception = e
+		}
+	}
+	if exception == nil {
+		t.Fatal("packet has no exception")
+	}
+	if expected := "*raven.testPanicError"; exception.Type != expected {
+		t.Errorf("incorrect Type: got %s, want %s", exception.Type, expected)
+	}
+	if expected := "test panic error"; exception.Value != expected {
+		t.Errorf("incorrect Value: got %s, want %s", exception.Value, expected)
+	}
+}
+
+func TestRecoveryHandlerWithTags(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	handler := RecoveryHandlerWithTags(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}, func(r *http.Request) map[string]string {
+		return map[string]string{"request_id": r.Header.Get("Foo")}
+	})
+
+	withDefaultClient(client, func() {
+		handler(httptest.NewRecorder(), newBaseRequest())
+		client.Wait()
+	})
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	if expected := (Tags{{"request_id", "bar"}}); !reflect.DeepEqual(packets[0].Tags, expected) {
+		t.Errorf("incorrect Tags: got %+v, want %+v", packets[0].Tags, expected)
+	}
+}
+
+func TestCaptureRequestError(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	req := newBaseRequest()
+	req.URL.RawQuery = "password=hunter2"
+
+	withDefaultClient(client, func() {
+		CaptureRequestError(errors.New("request failed"), req, map[string]string{"foo": "bar"})
+		client.Wait()
+	})
+
+	packets := transport.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets: got %d, want 1", len(packets))
+	}
+	var exception *Exception
+	var h *Http
+	for _, inter := range packets[0].Interfaces {
+		switch inter := inter.(type) {
+		case *Exceptions:
+			exception = inter.Values[len(inter.Values)-1]
+		case *Http:
+			h = inter
+		}
+	}
+	if h == nil || h.Query != "password=%2A%2A%2A%2A%2A%2A%2A%2A" {
+		t.Errorf("incorrect Http: got %+v", h)
+	}
+	if exception == nil {
+		t.Fatal("packet has no exception")
+	}
+	f := exception.Stacktrace.Frames[len(exception.Stacktrace.Frames)-1]
+	if actual, expected := f.Module+"."+f.Function, thisPackage+".TestCaptureRequestError.func1"; actual != expected {
+		t.Errorf("incorrect top frame: got %s, want %s", actual, expected)
+	}
+}
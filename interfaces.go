@@ -1,5 +1,31 @@
 package raven
 
+import (
+	"reflect"
+	"strings"
+)
+
+// An emptier is an Interface which can hold no data worth sending, and is
+// then left out of the JSON of its packet.
+type emptier interface {
+	isEmpty() bool
+}
+
+// isEmptyInterface reports whether inter holds no data worth sending, being
+// nil, a nil pointer or an empty emptier.
+func isEmptyInterface(inter Interface) bool {
+	if inter == nil {
+		return true
+	}
+	if v := reflect.ValueOf(inter); v.Kind() == reflect.Ptr && v.IsNil() {
+		return true
+	}
+	if e, ok := inter.(emptier); ok {
+		return e.isEmpty()
+	}
+	return false
+}
+
 // https://docs.getsentry.com/hosted/clientdev/interfaces/#message-interface
 type Message struct {
 	// Required
@@ -7,10 +33,44 @@ type Message struct {
 
 	// Optional
 	Params []interface{} `json:"params,omitempty"`
+
+	// Optional, the message formatted with its params
+	Formatted string `json:"formatted,omitempty"`
 }
 
 func (m *Message) Class() string { return "logentry" }
 
+// A legacyMessage is a Message sent as the message interface which preceded
+// logentry, for older Sentry servers.
+type legacyMessage struct {
+	*Message
+}
+
+func (m legacyMessage) Class() string { return "sentry.interfaces.Message" }
+
+// SetLegacyMessageInterface sets whether messages are sent as the legacy
+// sentry.interfaces.Message interface, for Sentry servers older than 8.0
+// which do not know logentry.
+func (client *Client) SetLegacyMessageInterface(legacy bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.legacyMessageInterface = legacy
+}
+
+// SetLegacyMessageInterface sets whether the default *Client sends messages as
+// the legacy message interface.
+func SetLegacyMessageInterface(legacy bool) { DefaultClient.SetLegacyMessageInterface(legacy) }
+
+// useLegacyMessage sends the messages of the packet as the legacy message
+// interface.
+func (packet *Packet) useLegacyMessage() {
+	for i, inter := range packet.Interfaces {
+		if m, ok := inter.(*Message); ok && m != nil {
+			packet.Interfaces[i] = legacyMessage{m}
+		}
+	}
+}
+
 // https://docs.getsentry.com/hosted/clientdev/interfaces/#template-interface
 type Template struct {
 	// Required
@@ -37,6 +97,19 @@ type User struct {
 
 func (h *User) Class() string { return "user" }
 
+func (h *User) isEmpty() bool { return *h == User{} }
+
+// SetIPAddress sets the user's IP address to the address of the client making
+// the request h, as recorded by NewHttp. It does nothing if h has none.
+func (h *User) SetIPAddress(req *Http) {
+	if req == nil {
+		return
+	}
+	if addr := req.Env["REMOTE_ADDR"]; addr != "" {
+		h.IP = addr
+	}
+}
+
 // https://docs.getsentry.com/hosted/clientdev/interfaces/#context-interfaces
 type Query struct {
 	// Required
@@ -47,3 +120,105 @@ type Query struct {
 }
 
 func (q *Query) Class() string { return "query" }
+
+// RedactLiterals replaces the string and number literals of the query by
+// placeholders, for queries whose values may be sensitive. Double-quoted
+// strings are left alone, as they are identifiers in standard SQL, and so are
+// numbered placeholders such as $1. Backslashes escape the next character of
+// a string when Engine is mysql or mariadb, as they do by default there.
+func (q *Query) RedactLiterals() {
+	var redacted []byte
+	query := q.Query
+	backslashEscapes := strings.EqualFold(q.Engine, "mysql") || strings.EqualFold(q.Engine, "mariadb")
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// Skip to the closing quote, where two quotes are an escaped one
+			for i++; i < len(query); i++ {
+				if backslashEscapes && query[i] == '\\' {
+					i++
+					continue
+				}
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			redacted = append(redacted, '?')
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			// Keep numbered placeholders such as $1, which are not literals
+			for redacted = append(redacted, c); i+1 < len(query) && isDigit(query[i+1]); i++ {
+				redacted = append(redacted, query[i+1])
+			}
+		case c == '0' && i+2 < len(query) && (query[i+1] == 'x' || query[i+1] == 'X') && isHexDigit(query[i+2]) &&
+			(i == 0 || !isIdentifierByte(query[i-1])):
+			// Hex literals such as 0x1F are a single literal
+			for i += 2; i+1 < len(query) && isHexDigit(query[i+1]); {
+				i++
+			}
+			redacted = append(redacted, '?')
+		case isDigit(c) && (i == 0 || !isIdentifierByte(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			// Include an exponent, such as the e10 of 1e10 or the E-3 of 2.5E-3
+			if j := i + 1; j < len(query) && (query[j] == 'e' || query[j] == 'E') {
+				if j++; j < len(query) && (query[j] == '+' || query[j] == '-') {
+					j++
+				}
+				if j < len(query) && isDigit(query[j]) {
+					for i = j; i+1 < len(query) && isDigit(query[i+1]); {
+						i++
+					}
+				}
+			}
+			redacted = append(redacted, '?')
+		case isIdentifierByte(c):
+			// Copy the whole word, so that digits within it are kept
+			for ; i < len(query) && isIdentifierByte(query[i]); i++ {
+				redacted = append(redacted, query[i])
+			}
+			i--
+		default:
+			redacted = append(redacted, c)
+		}
+	}
+	q.Query = string(redacted)
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isHexDigit(c byte) bool { return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// The fingerprint element standing for the grouping Sentry would use by default.
+const DefaultFingerprint = "{{ default }}"
+
+// A Fingerprint sets the Fingerprint of the packet it is passed with, to
+// control how Sentry groups it with other events. It can be passed along with
+// the interfaces of a packet, for example:
+//
+//	raven.CaptureError(err, nil, raven.Fingerprint{"database-unavailable"})
+//
+// https://docs.sentry.io/learn/rollups/#custom-grouping
+type Fingerprint []string
+
+func (f Fingerprint) Class() string { return "fingerprint" }
+
+func (f Fingerprint) apply(packet *Packet) { packet.Fingerprint = f }
+
+// A Transaction sets the Transaction of the packet it is passed with, naming
+// the operation, such as a route or an RPC method, in which the event
+// occurred.
+type Transaction string
+
+func (t Transaction) Class() string { return "transaction" }
+
+func (t Transaction) apply(packet *Packet) { packet.Transaction = string(t) }
@@ -0,0 +1,118 @@
+package raven
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserJSON(t *testing.T) {
+	req := newBaseRequest()
+	req.RemoteAddr = "203.0.113.7:51234"
+
+	user := &User{ID: "42", Username: "alice", Email: "alice@example.com"}
+	user.SetIPAddress(NewHttp(req))
+
+	packet := NewPacket("test", user)
+	j, err := packet.JSON()
+	if err != nil {
+		t.Fatalf("JSON marshalling should not fail: %v", err)
+	}
+	var actual struct {
+		User map[string]string `json:"user"`
+	}
+	if err := json.Unmarshal(j, &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"id": "42", "username": "alice", "email": "alice@example.com", "ip_address": "203.0.113.7"}
+	if len(actual.User) != len(expected) {
+		t.Errorf("incorrect user: got %v, want %v", actual.User, expected)
+	}
+	for k, v := range expected {
+		if actual.User[k] != v {
+			t.Errorf("incorrect user %s: got %q, want %q", k, actual.User[k], v)
+		}
+	}
+}
+
+func TestUserSetIPAddressWithoutHttp(t *testing.T) {
+	user := &User{IP: "203.0.113.7"}
+	user.SetIPAddress(nil)
+	user.SetIPAddress(&Http{})
+	if user.IP != "203.0.113.7" {
+		t.Errorf("incorrect IP: got %q, want 203.0.113.7", user.IP)
+	}
+}
+
+func TestPacketJSONOmitsEmptyInterfaces(t *testing.T) {
+	var nilUser *User
+	var nilHttp *Http
+	for _, test := range []struct {
+		interfaces []Interface
+		omitted    []string
+		present    []string
+	}{
+		{[]Interface{&User{}, &Http{}}, []string{`"user"`, `"request"`}, nil},
+		{[]Interface{nilUser, nilHttp, nil}, []string{`"user"`, `"request"`}, nil},
+		{[]Interface{&User{ID: "42"}, &Http{URL: "http://example.com/"}}, nil, []string{`"user":{"id":"42"}`, `"request":{"url":"http://example.com/"`}},
+		{[]Interface{&User{ID: "42"}, &User{}}, nil, []string{`"user":{"id":"42"}`}},
+	} {
+		j, err := NewPacket("test", test.interfaces...).JSON()
+		if err != nil {
+			t.Fatalf("JSON marshalling should not fail: %v", err)
+		}
+		for _, key := range test.omitted {
+			if strings.Contains(string(j), key) {
+				t.Errorf("empty %s was not omitted: got %s", key, j)
+			}
+		}
+		for _, fragment := range test.present {
+			if !strings.Contains(string(j), fragment) {
+				t.Errorf("missing %s: got %s", fragment, j)
+			}
+		}
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	query := &Query{Query: "SELECT * FROM users WHERE email = 'alice@example.com' AND id = 42", Engine: "postgres"}
+	packet := NewPacket("query failed", query)
+	j, err := packet.JSON()
+	if err != nil {
+		t.Fatalf("JSON marshalling should not fail: %v", err)
+	}
+	var actual struct {
+		Query map[string]string `json:"query"`
+	}
+	if err := json.Unmarshal(j, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Query["query"] != query.Query || actual.Query["engine"] != "postgres" {
+		t.Errorf("incorrect query: got %v", actual.Query)
+	}
+}
+
+func TestQueryRedactLiterals(t *testing.T) {
+	for _, test := range []struct {
+		engine   string
+		query    string
+		expected string
+	}{
+		{"", "SELECT * FROM users WHERE email = 'alice@example.com' AND id = 42", "SELECT * FROM users WHERE email = ? AND id = ?"},
+		{"", "UPDATE t1 SET name = 'O''Brien', score = 3.5 WHERE \"col2\" = -7", "UPDATE t1 SET name = ?, score = ? WHERE \"col2\" = -?"},
+		{"", "SELECT 1", "SELECT ?"},
+		{"", "SELECT 'unterminated", "SELECT ?"},
+		{"", "SELECT * FROM users WHERE id = $1 AND name = $12", "SELECT * FROM users WHERE id = $1 AND name = $12"},
+		{"", "SELECT * FROM blobs WHERE hash = 0x1F AND flags = 0XaB0 AND id = 0", "SELECT * FROM blobs WHERE hash = ? AND flags = ? AND id = ?"},
+		{"", "SELECT 1e10, 2.5E-3, 7e+2 FROM t", "SELECT ?, ?, ? FROM t"},
+		{"mysql", "SELECT * FROM users WHERE name = 'it\\'s' AND password = 'secret'", "SELECT * FROM users WHERE name = ? AND password = ?"},
+		{"MySQL", "SELECT 'a\\\\' , 'b'", "SELECT ? , ?"},
+		{"postgres", "SELECT 'C:\\' AS dir, 'secret'", "SELECT ? AS dir, ?"},
+	} {
+		query := &Query{Query: test.query, Engine: test.engine}
+		query.RedactLiterals()
+		if query.Query != test.expected {
+			t.Errorf("incorrect redaction of %q: got %q, want %q", test.query, query.Query, test.expected)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package raven
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrPacketTooLarge = errors.New("raven: packet too large")
+
+// The default maximum lengths in bytes of the values that Sentry would
+// otherwise truncate, or reject the whole event for.
+const (
+	defaultMaxTagValueLength    = 200
+	defaultMaxHeaderValueLength = 8192
+	defaultMaxExtraValueLength  = 16384
+)
+
+// The maximum length of tag keys, which Sentry also restricts to
+// alphanumerics and the characters in tagKeyPunctuation.
+const (
+	maxTagKeyLength   = 32
+	tagKeyPunctuation = "_.:-"
+)
+
+// The default maximum size in bytes of the JSON of a packet, beyond which
+// Sentry rejects the event.
+const defaultMaxPacketBytes = 1 << 20
+
+// The marker ending truncated values.
+const truncatedSuffix = "..."
+
+// valueLimits are the maximum lengths of the values of a packet, and the
+// maximum sizes of its attachments and JSON. A negative length leaves the
+// values untruncated.
+type valueLimits struct {
+	tag, header, extra int
+	attachment, packet int
+}
+
+func SetMaxTagValueLength(n int) { DefaultClient.SetMaxTagValueLength(n) }
+
+// SetMaxTagValueLength sets the maximum length in bytes of tag values. Longer
+// values are truncated before the packet is sent, ending with "...". The
+// default length of 200 is used when n is 0, and a negative n disables the
+// truncation.
+func (client *Client) SetMaxTagValueLength(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxTagValueLength = n
+}
+
+func SetMaxHeaderValueLength(n int) { DefaultClient.SetMaxHeaderValueLength(n) }
+
+// SetMaxHeaderValueLength sets the maximum length in bytes of the header and
+// cookie values of requests, which are truncated like tag values. The default
+// length is 8192.
+func (client *Client) SetMaxHeaderValueLength(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxHeaderValueLength = n
+}
+
+func SetMaxExtraValueLength(n int) { DefaultClient.SetMaxExtraValueLength(n) }
+
+// SetMaxExtraValueLength sets the maximum length in bytes of the string values
+// of extra data, which are truncated like tag values. The default length is
+// 16384.
+func (client *Client) SetMaxExtraValueLength(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxExtraValueLength = n
+}
+
+func SetMaxPacketBytes(n int) { DefaultClient.SetMaxPacketBytes(n) }
+
+// SetMaxPacketBytes sets the maximum size in bytes of the JSON of packets,
+// before compression. A larger packet is trimmed until it fits, by leaving out
+// the source context of its stack traces, then its extra data, and then its
+// breadcrumbs. If it is still too large, it is dropped with ErrPacketTooLarge
+// and counted by OversizedEvents. The default size of 1MB, the limit of
+// Sentry, is used when n is 0, and a negative n removes the limit.
+func (client *Client) SetMaxPacketBytes(n int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.maxPacketBytes = n
+}
+
+// valueLimits returns the maximum lengths of the values of the packets sent by
+// the client. It must be called with the client's lock held.
+func (client *Client) valueLimits() valueLimits {
+	return valueLimits{
+		tag:    lengthOrDefault(client.maxTagValueLength, defaultMaxTagValueLength),
+		header: lengthOrDefault(client.maxHeaderValueLength, defaultMaxHeaderValueLength),
+		extra:  lengthOrDefault(client.maxExtraValueLength, defaultMaxExtraValueLength),
+
+		attachment: lengthOrDefault(client.maxAttachmentBytes, defaultMaxAttachmentBytes),
+		packet:     lengthOrDefault(client.maxPacketBytes, defaultMaxPacketBytes),
+	}
+}
+
+func lengthOrDefault(n, defaultLength int) int {
+	if n == 0 {
+		return defaultLength
+	}
+	return n
+}
+
+// truncateValues truncates the values of the packet longer than limits. The
+// request is copied rather than modified, since it may be shared with other
+// packets. The goroutine dump is left alone, as its size is already limited by
+// SetGoroutineDumpBytes.
+func (packet *Packet) truncateValues(limits valueLimits) {
+	for key, value := range packet.Extra {
+		if s, ok := value.(string); ok && key != goroutinesExtraKey {
+			packet.Extra[key] = truncate(s, limits.extra)
+		}
+	}
+	for i, inter := range packet.Interfaces {
+		if h, ok := inter.(*Http); ok && h.hasLongValues(limits.header) {
+			packet.Interfaces[i] = h.truncated(limits.header)
+		}
+	}
+}
+
+// sanitizeTags makes the tags of the packet meet the constraints of Sentry,
+// which would otherwise drop them or reject the whole event. Invalid
+// characters of keys are replaced with underscores and long keys are
+// truncated, while line breaks in values are replaced with spaces and values
+// longer than n bytes are truncated. Keys which collide once sanitized, such
+// as "a b" and "a/b", keep the first value, like addMissingTags. It returns
+// the number of tags changed or left out.
+func (packet *Packet) sanitizeTags(n int) int {
+	sanitized := 0
+	seen := make(map[string]bool, len(packet.Tags))
+	tags := packet.Tags[:0]
+	for _, tag := range packet.Tags {
+		key := sanitizeTagKey(tag.Key)
+		if seen[key] {
+			sanitized++
+			continue
+		}
+		seen[key] = true
+		value := truncate(strings.Map(func(r rune) rune {
+			if r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, tag.Value), n)
+		if key != tag.Key || value != tag.Value {
+			sanitized++
+		}
+		tags = append(tags, Tag{key, value})
+	}
+	packet.Tags = tags
+	return sanitized
+}
+
+func sanitizeTagKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune(tagKeyPunctuation, r) {
+			return r
+		}
+		return '_'
+	}, key)
+	if len(key) > maxTagKeyLength {
+		key = key[:maxTagKeyLength]
+	}
+	return key
+}
+
+func (h *Http) hasLongValues(n int) bool {
+	if n < 0 {
+		return false
+	}
+	if len(h.Cookies) > n {
+		return true
+	}
+	for _, value := range h.Headers {
+		if len(value) > n {
+			return true
+		}
+	}
+	for _, value := range h.CookieMap {
+		if len(value) > n {
+			return true
+		}
+	}
+	return false
+}
+
+// truncated returns a copy of the request with its header and cookie values
+// truncated to n bytes.
+func (h *Http) truncated(n int) *Http {
+	copied := *h
+	copied.Cookies = truncate(h.Cookies, n)
+	copied.Headers = truncateMap(h.Headers, n)
+	copied.CookieMap = truncateMap(h.CookieMap, n)
+	return &copied
+}
+
+func truncateMap(values map[string]string, n int) map[string]string {
+	if values == nil {
+		return nil
+	}
+	truncated := make(map[string]string, len(values))
+	for key, value := range values {
+		truncated[key] = truncate(value, n)
+	}
+	return truncated
+}
+
+// truncate returns s cut to at most n bytes, on a character boundary, and
+// ending with truncatedSuffix if it was longer. A negative n leaves s as is.
+func truncate(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	if n <= len(truncatedSuffix) {
+		return truncatedSuffix[:n]
+	}
+	cut := n - len(truncatedSuffix)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedSuffix
+}
+
+// fit trims the packet until its JSON is at most n bytes, reporting whether it
+// fits. A negative n leaves the packet as is.
+func (packet *Packet) fit(n int) bool {
+	if n < 0 {
+		return true
+	}
+	for _, trim := range []func(){
+		packet.dropSourceContext,
+		func() { packet.Extra = nil },
+		packet.dropBreadcrumbs,
+	} {
+		if packet.fits(n) {
+			return true
+		}
+		trim()
+	}
+	return packet.fits(n)
+}
+
+// fits reports whether the JSON of the packet is at most n bytes. A packet
+// which can't be serialized is left for the transport to report.
+func (packet *Packet) fits(n int) bool {
+	b, err := packet.JSON()
+	return err != nil || len(b) <= n
+}
+
+// dropSourceContext leaves the source context out of the stack traces of the
+// packet. The interfaces holding them are copied rather than modified, since
+// they may be shared with other packets.
+func (packet *Packet) dropSourceContext() {
+	for i, inter := range packet.Interfaces {
+		switch inter := inter.(type) {
+		case *Stacktrace:
+			packet.Interfaces[i] = inter.withoutContext()
+		case *Exception:
+			packet.Interfaces[i] = inter.withoutContext()
+		case *Exceptions:
+			copied := &Exceptions{Values: make([]*Exception, len(inter.Values))}
+			for j, ex := range inter.Values {
+				copied.Values[j] = ex.withoutContext()
+			}
+			packet.Interfaces[i] = copied
+		case *Threads:
+			copied := &Threads{Values: make([]*Thread, len(inter.Values))}
+			for j, thread := range inter.Values {
+				copiedThread := *thread
+				copiedThread.Stacktrace = thread.Stacktrace.withoutContext()
+				copied.Values[j] = &copiedThread
+			}
+			packet.Interfaces[i] = copied
+		}
+	}
+}
+
+func (packet *Packet) dropBreadcrumbs() {
+	interfaces := packet.Interfaces[:0:0]
+	for _, inter := range packet.Interfaces {
+		if inter.Class() != "breadcrumbs" {
+			interfaces = append(interfaces, inter)
+		}
+	}
+	packet.Interfaces = interfaces
+}
+
+func (e *Exception) withoutContext() *Exception {
+	copied := *e
+	copied.Stacktrace = e.Stacktrace.withoutContext()
+	return &copied
+}
+
+// withoutContext returns a copy of the stack trace, which may be nil, without
+// the source lines of its frames.
+func (s *Stacktrace) withoutContext() *Stacktrace {
+	if s == nil {
+		return nil
+	}
+	copied := &Stacktrace{Frames: make([]*StacktraceFrame, len(s.Frames)), FramesOmitted: s.FramesOmitted}
+	for i, frame := range s.Frames {
+		copiedFrame := *frame
+		copiedFrame.ContextLine, copiedFrame.PreContext, copiedFrame.PostContext = "", nil, nil
+		copied.Frames[i] = &copiedFrame
+	}
+	return copied
+}
@@ -0,0 +1,165 @@
+package raven
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"much too long", 10, "much to..."},
+		{"héllo wörld", 9, "héllo..."},
+		{"日本語のテキスト", 10, "日本..."},
+		{"too long", 2, ".."},
+		{"too long", -1, "too long"},
+	} {
+		if actual := truncate(test.s, test.n); actual != test.expected {
+			t.Errorf("incorrect truncation of %q to %d: got %q, want %q", test.s, test.n, actual, test.expected)
+		}
+	}
+}
+
+func TestCaptureTruncatesValues(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.SetMaxHeaderValueLength(100)
+	client.SetMaxExtraValueLength(-1)
+
+	cookie := strings.Repeat("a", 50*1024)
+	h := &Http{URL: "http://example.com/", Method: "GET", Cookies: cookie, Headers: map[string]string{"Cookie": cookie, "Accept": "*/*"}}
+	packet := NewPacket("boom", h)
+	packet.Extra["body"] = cookie
+	client.Capture(packet, map[string]string{"long": strings.Repeat("b", 300)})
+	client.Wait()
+
+	sent := transport.Packets()[0]
+	var sentHttp *Http
+	for _, inter := range sent.Interfaces {
+		if h, ok := inter.(*Http); ok {
+			sentHttp = h
+		}
+	}
+	if header := sentHttp.Headers["Cookie"]; len(header) != 100 || !strings.HasSuffix(header, "...") {
+		t.Errorf("incorrect truncated header of %d bytes: %q", len(header), header)
+	}
+	if len(sentHttp.Cookies) != 100 {
+		t.Errorf("incorrect length of truncated cookies: got %d, want 100", len(sentHttp.Cookies))
+	}
+	if sentHttp.Headers["Accept"] != "*/*" {
+		t.Errorf("incorrect Accept header: got %q", sentHttp.Headers["Accept"])
+	}
+	if len(h.Headers["Cookie"]) != len(cookie) {
+		t.Error("the captured request was modified")
+	}
+	if actual := tagValue(sent.Tags, "long"); len(actual) != defaultMaxTagValueLength {
+		t.Errorf("incorrect length of truncated tag: got %d, want %d", len(actual), defaultMaxTagValueLength)
+	}
+	if sent.Extra["body"] != cookie {
+		t.Error("extra value was truncated after SetMaxExtraValueLength(-1)")
+	}
+}
+
+func TestSanitizeTags(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	longKey := "customer.subscription.billing_period"
+	client.Capture(NewPacket("boom"), map[string]string{
+		longKey:     "monthly",
+		"order id":  "42",
+		"query":     "SELECT *\nFROM orders\r\n",
+		"valid_key": "value",
+	})
+	client.Wait()
+
+	tags := transport.Packets()[0].Tags
+	if actual := tagValue(tags, longKey[:maxTagKeyLength]); actual != "monthly" {
+		t.Errorf("over-long key was not truncated: got %v", tags)
+	}
+	if actual := tagValue(tags, "order_id"); actual != "42" {
+		t.Errorf("invalid key characters were not replaced: got %v", tags)
+	}
+	if actual := tagValue(tags, "query"); actual != "SELECT * FROM orders  " {
+		t.Errorf("incorrect value with line breaks: got %q", actual)
+	}
+	if actual := tagValue(tags, "valid_key"); actual != "value" {
+		t.Errorf("incorrect valid tag: got %q", actual)
+	}
+	if sanitized := client.SanitizedTags(); sanitized != 3 {
+		t.Errorf("incorrect number of sanitized tags: got %d, want 3", sanitized)
+	}
+
+	// Keys colliding once sanitized keep the first value
+	packet := NewPacket("boom")
+	packet.Tags = Tags{{"a b", "1"}, {"a/b", "2"}, {"a_b", "3"}, {"c", "4"}}
+	client.Capture(packet, nil)
+	client.Wait()
+
+	expected := Tags{{"a_b", "1"}, {"c", "4"}}
+	if tags := transport.Packets()[1].Tags; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("incorrect tags with colliding keys: got %v, want %v", tags, expected)
+	}
+	if sanitized := client.SanitizedTags(); sanitized != 6 {
+		t.Errorf("incorrect number of sanitized tags: got %d, want 6", sanitized)
+	}
+}
+
+func TestSetMaxPacketBytes(t *testing.T) {
+	client, transport := NewTestClient()
+	client.SetMaxPacketBytes(8192)
+
+	packet := NewPacket("huge extra")
+	packet.Extra = make(map[string]interface{})
+	for i := 0; i < 1000; i++ {
+		packet.Extra[fmt.Sprintf("key%d", i)] = strings.Repeat("v", 100)
+	}
+	client.Capture(packet, nil)
+	client.Wait()
+
+	sent := transport.LastEvent()
+	if b, _ := sent.JSON(); len(b) > 8192 {
+		t.Errorf("packet was not trimmed: got %d bytes", len(b))
+	}
+	if len(sent.Extra) != 0 {
+		t.Errorf("extra was not dropped: got %d values", len(sent.Extra))
+	}
+	if sent.Message != "huge extra" {
+		t.Errorf("incorrect Message: got %s", sent.Message)
+	}
+
+	// The source context is dropped first, keeping the extra data
+	frames := make([]*StacktraceFrame, 50)
+	for i := range frames {
+		frames[i] = &StacktraceFrame{Filename: "main.go", Lineno: i + 1, ContextLine: strings.Repeat("x", 100), PreContext: []string{strings.Repeat("x", 100)}}
+	}
+	packet = NewPacket("huge context", &Stacktrace{Frames: frames})
+	packet.Extra = map[string]interface{}{"order": "1"}
+	client.Capture(packet, nil)
+	client.Wait()
+
+	sent = transport.LastEvent()
+	if sent.Extra["order"] != "1" {
+		t.Errorf("extra was dropped: got %v", sent.Extra)
+	}
+	for _, inter := range sent.Interfaces {
+		if s, ok := inter.(*Stacktrace); ok && (s.Frames[0].ContextLine != "" || s.Frames[0].PreContext != nil) {
+			t.Error("source context was not dropped")
+		}
+	}
+	if frames[0].ContextLine == "" {
+		t.Error("frames of the caller were modified")
+	}
+
+	_, ch := client.Capture(NewPacket(strings.Repeat("m", 10000)), nil)
+	if err := <-ch; err != ErrPacketTooLarge {
+		t.Errorf("incorrect error of an oversized packet: got %v, want %v", err, ErrPacketTooLarge)
+	}
+	if oversized := client.OversizedEvents(); oversized != 1 {
+		t.Errorf("incorrect OversizedEvents: got %d, want 1", oversized)
+	}
+}
@@ -0,0 +1,161 @@
+// Package ravenlogrus provides a logrus hook that reports log entries to
+// Sentry.
+//
+//	hook := ravenlogrus.NewHook(nil, nil)
+//	logrus.AddHook(hook)
+//
+//	logrus.WithError(err).Error("failed to save the order")
+package ravenlogrus
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/sirupsen/logrus"
+)
+
+// The levels a Hook reports when NewHook is not given any.
+var defaultLevels = []logrus.Level{
+	logrus.PanicLevel,
+	logrus.FatalLevel,
+	logrus.ErrorLevel,
+}
+
+// How long firing the hook with a fatal or panic entry waits for the captured
+// events to be sent, before logrus exits or panics.
+const flushTimeout = 5 * time.Second
+
+// The import paths of this package and of logrus, whose frames are left out
+// of the stacktraces of reported entries.
+var (
+	hookPackage   = reflect.TypeOf(Hook{}).PkgPath()
+	logrusPackage = reflect.TypeOf(logrus.Entry{}).PkgPath()
+)
+
+// A Hook reports the log entries of the levels it was created with to Sentry
+// as packets. Entries are captured asynchronously, so firing the hook does not
+// wait for them to be sent, except for fatal and panic entries: logrus exits
+// or panics right after firing the hook, so it waits up to 5 seconds for them,
+// and the events captured before them, to be sent.
+type Hook struct {
+	client *raven.Client
+	levels []logrus.Level
+
+	// Names of entry fields reported as tags. Any other field is reported as
+	// extra data.
+	TagFields []string
+}
+
+// NewHook returns a hook reporting entries of the given levels through client.
+// A nil client uses raven.DefaultClient and nil levels report entries of the
+// error level and above.
+func NewHook(client *raven.Client, levels []logrus.Level) *Hook {
+	if client == nil {
+		client = raven.DefaultClient
+	}
+	if levels == nil {
+		levels = defaultLevels
+	}
+	return &Hook{client: client, levels: levels}
+}
+
+// Levels returns the levels of the entries reported by the hook.
+func (hook *Hook) Levels() []logrus.Level { return hook.levels }
+
+// Fire captures the entry as a packet.
+func (hook *Hook) Fire(entry *logrus.Entry) error {
+	hook.client.Capture(hook.packet(entry), nil)
+	if entry.Level == logrus.FatalLevel || entry.Level == logrus.PanicLevel {
+		hook.client.Flush(flushTimeout)
+	}
+	return nil
+}
+
+// packet converts an entry to a packet. The field holding the error, if any,
+// is reported as an exception with its stacktrace.
+func (hook *Hook) packet(entry *logrus.Entry) *raven.Packet {
+	packet := raven.NewPacket(entry.Message)
+	packet.Timestamp = raven.Timestamp(entry.Time)
+	packet.Level = severity(entry.Level)
+	packet.Culprit = entry.Message
+
+	var err error
+	tags := make(map[string]string)
+	for key, value := range entry.Data {
+		if fieldErr, ok := value.(error); ok && key == logrus.ErrorKey {
+			err = fieldErr
+			continue
+		}
+		if hook.isTagField(key) {
+			tags[key] = fmt.Sprint(value)
+			continue
+		}
+		if fieldErr, ok := value.(error); ok {
+			// Most errors have no exported fields to marshal
+			value = fieldErr.Error()
+		}
+		packet.Extra[key] = value
+	}
+	packet.AddTags(tags)
+
+	if err != nil {
+		packet.Interfaces = append(packet.Interfaces, raven.NewExceptions(err, hook.stacktrace(err)))
+	} else {
+		packet.Interfaces = append(packet.Interfaces, &raven.Message{Message: entry.Message})
+	}
+	return packet
+}
+
+func (hook *Hook) isTagField(key string) bool {
+	for _, field := range hook.TagFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stacktrace returns the stacktrace recorded by err if it has one, and
+// otherwise the stacktrace of the code that logged the entry.
+func (hook *Hook) stacktrace(err error) *raven.Stacktrace {
+	context, prefixes := hook.client.ContextLines(), hook.client.IncludePaths()
+	if stacktrace := raven.NewStacktraceFromError(err, context, prefixes); stacktrace != nil {
+		return stacktrace
+	}
+
+	stacktrace := raven.NewStacktrace(0, context, prefixes)
+	if stacktrace == nil {
+		return nil
+	}
+	frames := stacktrace.Frames
+	for len(frames) > 0 && (inPackage(frames[len(frames)-1], hookPackage) || inPackage(frames[len(frames)-1], logrusPackage)) {
+		frames = frames[:len(frames)-1]
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	stacktrace.Frames = frames
+	return stacktrace
+}
+
+func inPackage(frame *raven.StacktraceFrame, pack string) bool {
+	return frame.Module == pack || strings.HasPrefix(frame.Module, pack+".")
+}
+
+// severity returns the Sentry severity matching a logrus level.
+func severity(level logrus.Level) raven.Severity {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return raven.FATAL
+	case logrus.ErrorLevel:
+		return raven.ERROR
+	case logrus.WarnLevel:
+		return raven.WARNING
+	case logrus.InfoLevel:
+		return raven.INFO
+	}
+	return raven.DEBUG
+}
@@ -0,0 +1,30 @@
+package raven
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	client, transport := NewTestClient()
+	if transport.LastEvent() != nil {
+		t.Error("unexpected event before any capture")
+	}
+
+	client.CaptureMessage("first", nil)
+	client.Wait()
+	client.CaptureError(errors.New("second"), nil)
+	client.Wait()
+
+	if packets := transport.Packets(); len(packets) != 2 || packets[0].Message != "first" {
+		t.Fatalf("incorrect packets: got %v", packets)
+	}
+	if event := transport.LastEvent(); event == nil || event.Message != "second" {
+		t.Errorf("incorrect last event: got %v", event)
+	}
+
+	transport.Reset()
+	if len(transport.Packets()) != 0 || transport.LastEvent() != nil {
+		t.Error("packets recorded after Reset")
+	}
+}
@@ -0,0 +1,33 @@
+package raven
+
+func SetIncludeModules(include bool) { DefaultClient.SetIncludeModules(include) }
+
+// SetIncludeModules sets whether the versions of the modules the program was
+// built with are added to the Modules of every captured packet, keyed by
+// module path. They are not added by default, and there are none when the
+// program was built without module support, such as in GOPATH mode or by Go
+// versions older than 1.12.
+func (client *Client) SetIncludeModules(include bool) {
+	var modules map[string]string
+	if include {
+		modules = moduleVersions()
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.modules = modules
+}
+
+// packetModules returns a copy of the modules added to the client's packets,
+// or nil if there are none. It must be called with the client's lock held.
+func (client *Client) packetModules() map[string]string {
+	if len(client.modules) == 0 {
+		return nil
+	}
+	modules := make(map[string]string, len(client.modules))
+	for path, version := range client.modules {
+		modules[path] = version
+	}
+	return modules
+}
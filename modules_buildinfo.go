@@ -0,0 +1,26 @@
+//go:build go1.12
+// +build go1.12
+
+package raven
+
+import "runtime/debug"
+
+// readBuildInfo is replaced by tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// moduleVersions returns the versions of the main module and of the modules it
+// depends on, or nil if the program was built without module support.
+func moduleVersions() map[string]string {
+	info, ok := readBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return nil
+	}
+	modules := map[string]string{info.Main.Path: info.Main.Version}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		modules[dep.Path] = dep.Version
+	}
+	return modules
+}
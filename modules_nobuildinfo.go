@@ -0,0 +1,8 @@
+//go:build !go1.12
+// +build !go1.12
+
+package raven
+
+// moduleVersions returns nil, since build information is only available from
+// Go 1.12.
+func moduleVersions() map[string]string { return nil }
@@ -0,0 +1,51 @@
+//go:build go1.12
+// +build go1.12
+
+package raven
+
+import (
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestIncludeModules(t *testing.T) {
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+			Deps: []*debug.Module{
+				{Path: "github.com/pkg/errors", Version: "v0.8.1"},
+				{Path: "example.com/lib", Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.1"}},
+			},
+		}, true
+	}
+
+	client, transport := newRecordingClient(t)
+	client.Capture(NewPacket("boom"), nil)
+	client.SetIncludeModules(true)
+	client.Capture(NewPacket("boom"), nil)
+	client.Wait()
+
+	packets := transport.Packets()
+	if packets[0].Modules != nil {
+		t.Errorf("modules added without SetIncludeModules: got %v", packets[0].Modules)
+	}
+	expected := map[string]string{
+		"example.com/app":       "(devel)",
+		"github.com/pkg/errors": "v0.8.1",
+		"example.com/fork":      "v1.0.1",
+	}
+	if !reflect.DeepEqual(packets[1].Modules, expected) {
+		t.Errorf("incorrect modules: got %v, want %v", packets[1].Modules, expected)
+	}
+}
+
+func TestModuleVersionsWithoutBuildInfo(t *testing.T) {
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+
+	if modules := moduleVersions(); modules != nil {
+		t.Errorf("incorrect modules without build info: got %v", modules)
+	}
+}
@@ -0,0 +1,72 @@
+package raven
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Ping checks that the Sentry server of the client's DSN can be reached and
+// accepts its keys, without creating any event, so that a misconfigured DSN
+// can be flagged at startup or by a health check. It returns ErrMissingDSN
+// when the client has none, and ErrUnauthorized when the server rejects it.
+//
+// Only transports with a Ping(url, authHeader string) error method, such as
+// HTTPTransport, are checked. Others are assumed to be healthy.
+func (client *Client) Ping() error {
+	client.mu.RLock()
+	url, authHeader, transport := client.url, client.authHeader, client.Transport
+	client.mu.RUnlock()
+
+	if url == "" {
+		return ErrMissingDSN
+	}
+	if pinger, ok := transport.(interface {
+		Ping(url, authHeader string) error
+	}); ok {
+		return pinger.Ping(url, authHeader)
+	}
+	return nil
+}
+
+func Ping() error { return DefaultClient.Ping() }
+
+// Ping sends a request without any event to url, the endpoint events are sent
+// to. The server authenticates it like an event, but there is nothing in it to
+// store: an envelope endpoint is sent an empty envelope, and a store endpoint
+// an empty body, which it rejects with a 400 status once authenticated.
+func (t *HTTPTransport) Ping(url, authHeader string) error {
+	envelope := isEnvelopeURL(url)
+	var body []byte
+	contentType := "application/json"
+	if envelope {
+		body, contentType = []byte("{}\n"), envelopeContentType
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("can't create new request: %v", err)
+	}
+	req.Header.Set("X-Sentry-Auth", authHeader)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", contentType)
+	res, err := t.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == 401 || res.StatusCode == 403:
+		return ErrUnauthorized
+	case res.StatusCode == 429:
+		return ErrRateLimited
+	case res.StatusCode == 400 && !envelope:
+		return nil
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return fmt.Errorf("raven: got http status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package raven
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	status := 200
+	var path, auth string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("X-Sentry-Auth")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client, err := New(strings.Replace(server.URL, "http://", "http://public@", 1) + "/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = &HTTPTransport{Client: &http.Client{}}
+
+	// The store endpoint rejects the empty body once authenticated
+	status = 400
+	if err := client.Ping(); err != nil {
+		t.Errorf("incorrect result of a healthy store endpoint: got %v", err)
+	}
+	if path != "/api/1/store/" || len(body) != 0 {
+		t.Errorf("incorrect ping of the store endpoint: got %s %q", path, body)
+	}
+	if !strings.Contains(auth, "sentry_key=public") {
+		t.Errorf("incorrect X-Sentry-Auth header: got %s", auth)
+	}
+
+	client.SetUseEnvelope(true)
+	status = 200
+	if err := client.Ping(); err != nil {
+		t.Errorf("incorrect result of a healthy server: got %v", err)
+	}
+	if path != "/api/1/envelope/" || string(body) != "{}\n" {
+		t.Errorf("incorrect ping of the envelope endpoint: got %s %q", path, body)
+	}
+	status = 400
+	if err := client.Ping(); err == nil {
+		t.Error("envelope endpoint rejecting the ping was reported as healthy")
+	}
+
+	status = 401
+	if err := client.Ping(); err != ErrUnauthorized {
+		t.Errorf("incorrect result of a rejected DSN: got %v, want %v", err, ErrUnauthorized)
+	}
+	status = 502
+	if err := client.Ping(); err == nil || err.Error() != "raven: got http status 502" {
+		t.Errorf("incorrect result of a failing server: got %v", err)
+	}
+	if sent := client.SentEvents() + client.FailedEvents(); sent != 0 {
+		t.Errorf("ping was counted as an event: got %d", sent)
+	}
+
+	if err := (&Client{}).Ping(); err != ErrMissingDSN {
+		t.Errorf("incorrect result without a DSN: got %v, want %v", err, ErrMissingDSN)
+	}
+	if testClient, _ := NewTestClient(); testClient.Ping() != nil {
+		t.Errorf("incorrect result of a transport without Ping: got %v", testClient.Ping())
+	}
+}
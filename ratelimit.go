@@ -0,0 +1,68 @@
+package raven
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The time to wait after a 429 response without a valid Retry-After header.
+const defaultRetryAfter = 60 * time.Second
+
+// Returns the current time, replaced by tests.
+var timeNow = time.Now
+
+// rateLimitedUntil returns the time until which a Sentry response asks for no
+// more events to be sent, if it does.
+//
+// The X-Sentry-Rate-Limits header takes precedence over Retry-After, which is
+// only used for 429 responses. Rate limits for categories other than the
+// error events sent by this package are ignored.
+func rateLimitedUntil(res *http.Response, now time.Time) (time.Time, bool) {
+	if limits := res.Header.Get("X-Sentry-Rate-Limits"); limits != "" {
+		var until time.Time
+		for _, limit := range strings.Split(limits, ",") {
+			parts := strings.Split(strings.TrimSpace(limit), ":")
+			seconds, err := strconv.ParseFloat(parts[0], 64)
+			if err != nil {
+				continue
+			}
+			if len(parts) > 1 && !limitsErrorEvents(parts[1]) {
+				continue
+			}
+			if t := now.Add(time.Duration(seconds * float64(time.Second))); t.After(until) {
+				until = t
+			}
+		}
+		if !until.IsZero() {
+			return until, true
+		}
+	}
+
+	if res.StatusCode != 429 {
+		return time.Time{}, false
+	}
+	retryAfter := res.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(retryAfter); err == nil {
+		return t, true
+	}
+	return now.Add(defaultRetryAfter), true
+}
+
+// limitsErrorEvents reports whether a semicolon-separated list of rate limit
+// categories covers error events. An empty list covers every category.
+func limitsErrorEvents(categories string) bool {
+	if categories == "" {
+		return true
+	}
+	for _, category := range strings.Split(categories, ";") {
+		if category == "error" || category == "default" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package raven
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedUntil(t *testing.T) {
+	now := time.Date(2016, 11, 4, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		status int
+		header http.Header
+		until  time.Time
+		ok     bool
+	}{
+		{200, http.Header{}, time.Time{}, false},
+		{429, http.Header{"Retry-After": {"2"}}, now.Add(2 * time.Second), true},
+		{429, http.Header{"Retry-After": {"Fri, 04 Nov 2016 12:01:00 GMT"}}, now.Add(time.Minute), true},
+		{429, http.Header{}, now.Add(defaultRetryAfter), true},
+		{429, http.Header{"Retry-After": {"2"}, "X-Sentry-Rate-Limits": {"30:error:key"}}, now.Add(30 * time.Second), true},
+		{200, http.Header{"X-Sentry-Rate-Limits": {"60:transaction:key, 10::organization"}}, now.Add(10 * time.Second), true},
+		{200, http.Header{"X-Sentry-Rate-Limits": {"60:transaction;session:key"}}, time.Time{}, false},
+	} {
+		until, ok := rateLimitedUntil(&http.Response{StatusCode: test.status, Header: test.header}, now)
+		if !until.Equal(test.until) || ok != test.ok {
+			t.Errorf("incorrect rate limit for %d %v: got (%v, %t), want (%v, %t)", test.status, test.header, until, ok, test.until, test.ok)
+		}
+	}
+}
+
+func TestHTTPTransportRateLimited(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(429)
+	}))
+	defer server.Close()
+
+	client, _ := newRecordingClient(t)
+	transport := &HTTPTransport{Client: &http.Client{}}
+	client.Transport = transport
+	client.url = server.URL
+
+	for i := 0; i < 3; i++ {
+		if _, ch := client.Capture(NewPacket("boom"), nil); <-ch != ErrRateLimited {
+			t.Errorf("event %d was not rate limited", i)
+		}
+	}
+	mu.Lock()
+	if requests != 1 {
+		t.Errorf("incorrect number of requests while rate limited: got %d, want 1", requests)
+	}
+	mu.Unlock()
+	if !client.RateLimited() {
+		t.Error("client is not rate limited")
+	}
+
+	now = now.Add(2 * time.Second)
+	if client.RateLimited() {
+		t.Error("client is still rate limited after Retry-After")
+	}
+	client.Capture(NewPacket("boom"), nil)
+	client.Wait()
+	mu.Lock()
+	if requests != 2 {
+		t.Errorf("incorrect number of requests after Retry-After: got %d, want 2", requests)
+	}
+	mu.Unlock()
+}
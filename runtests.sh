@@ -1,4 +1,4 @@
 #!/bin/bash
-go test -race ./...
-go test -cover ./...
-go test -v ./...
+go test -race ${PACKAGES:-./...}
+go test -cover ${PACKAGES:-./...}
+go test -v ${PACKAGES:-./...}
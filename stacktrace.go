@@ -7,9 +7,13 @@ package raven
 
 import (
 	"bytes"
+	"container/list"
+	"fmt"
 	"go/build"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
@@ -19,6 +23,10 @@ import (
 type Stacktrace struct {
 	// Required
 	Frames []*StacktraceFrame `json:"frames"`
+
+	// Optional, the start and end indexes of the frames left out of a long
+	// stacktrace, if any.
+	FramesOmitted []int `json:"frames_omitted,omitempty"`
 }
 
 func (s *Stacktrace) Class() string { return "stacktrace" }
@@ -58,8 +66,135 @@ type StacktraceFrame struct {
 // appPackagePrefixes is a list of prefixes used to check whether a package should
 // be considered "in app".
 func NewStacktrace(skip int, context int, appPackagePrefixes []string) *Stacktrace {
+	return newStacktrace(callerFrames(2+skip, context, appPackagePrefixes))
+}
+
+// Initialize and populate a new stacktrace for a panic that is being
+// recovered, starting at the function that panicked.
+//
+// It must be called while the panic is unwinding, such as from a deferred
+// function that called recover. The frames of the deferred functions and of
+// the runtime's panic handling are skipped, so the trace does not depend on
+// where or how deeply the recovery is nested.
+//
+// context and appPackagePrefixes are the same as for NewStacktrace.
+func NewPanicStacktrace(context int, appPackagePrefixes []string) *Stacktrace {
+	frames := callerFrames(2, context, appPackagePrefixes)
+	if i := panicFrameIndex(frames); i != -1 {
+		frames = frames[i+1:]
+	} else {
+		for len(frames) > 0 && frames[0].inPackage(ravenPackage) {
+			frames = frames[1:]
+		}
+	}
+	// Skip the runtime functions which panicked, such as on a nil map write
+	for len(frames) > 0 && frames[0].inPackage("runtime") {
+		frames = frames[1:]
+	}
+	return newStacktrace(frames)
+}
+
+// panicFrameIndex returns the index of the frame of runtime.gopanic, which
+// calls the deferred functions of a panic, or -1 if there is none.
+func panicFrameIndex(frames []*StacktraceFrame) int {
+	for i, frame := range frames {
+		if frame.Module == "runtime" && frame.Function == "gopanic" {
+			return i
+		}
+	}
+	return -1
+}
+
+// The maximum number of causes followed when looking for the stack trace
+// attached to an error, in case an error is its own cause.
+const maxErrorDepth = 10
+
+// Initialize and populate a new stacktrace from the program counters recorded
+// by err when it was created, such as by github.com/pkg/errors.
+//
+// Any error with a StackTrace method returning a slice of uintptr-based values
+// is supported, and the causes of err (from Cause or Unwrap methods) are
+// searched for the one created closest to the origin of the error. Nil is
+// returned if none of them carries a stack trace.
+//
+// context and appPackagePrefixes are the same as for NewStacktrace.
+func NewStacktraceFromError(err error, context int, appPackagePrefixes []string) *Stacktrace {
+	var pcs []uintptr
+	for i := 0; err != nil && i < maxErrorDepth; i++ {
+		if errPCs := errorPCs(err); len(errPCs) > 0 {
+			pcs = errPCs
+		}
+		err = errorCause(err)
+	}
+	if pcs == nil {
+		return nil
+	}
+
 	var frames []*StacktraceFrame
-	for i := 1 + skip; ; i++ {
+	for _, pc := range pcs {
+		// The program counters are return addresses, so step back into
+		// the call instruction to get the right line.
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil {
+			continue
+		}
+		file, line := fn.FileLine(pc - 1)
+		frame := NewStacktraceFrame(pc-1, file, line, context, appPackagePrefixes)
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+	return newStacktrace(frames)
+}
+
+// errorPCs returns the program counters from err's StackTrace method, if it
+// has one returning a slice of uintptr-based values.
+func errorPCs(err error) []uintptr {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 {
+		return nil
+	}
+	stack := method.Call(nil)[0]
+	if stack.Kind() != reflect.Slice || stack.Type().Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	pcs := make([]uintptr, stack.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(stack.Index(i).Uint())
+	}
+	return pcs
+}
+
+// errorCause returns the error wrapped by err, or nil if it does not wrap one.
+func errorCause(err error) error {
+	switch err := err.(type) {
+	case interface {
+		Cause() error
+	}:
+		return err.Cause()
+	case interface {
+		Unwrap() error
+	}:
+		return err.Unwrap()
+	}
+	return nil
+}
+
+// inPackage reports whether the frame's function, method or closure belongs
+// to the package with the import path pack.
+func (f *StacktraceFrame) inPackage(pack string) bool {
+	return f.Module == pack || strings.HasPrefix(f.Module, pack+".")
+}
+
+// callerFrames builds frames for each caller of the function calling it,
+// starting skip frames up and ordered with the most recent call first.
+func callerFrames(skip int, context int, appPackagePrefixes []string) []*StacktraceFrame {
+	var frames []*StacktraceFrame
+	for i := skip; ; i++ {
 		pc, file, line, ok := runtime.Caller(i)
 		if !ok {
 			break
@@ -69,19 +204,66 @@ func NewStacktrace(skip int, context int, appPackagePrefixes []string) *Stacktra
 			frames = append(frames, frame)
 		}
 	}
+	return frames
+}
+
+func newStacktrace(frames []*StacktraceFrame) *Stacktrace {
 	// If there are no frames, the entire stacktrace is nil
 	if len(frames) == 0 {
 		return nil
 	}
 	// Optimize the path where there's only 1 frame
 	if len(frames) == 1 {
-		return &Stacktrace{frames}
+		return &Stacktrace{Frames: frames}
 	}
 	// Sentry wants the frames with the oldest first, so reverse them
 	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
 		frames[i], frames[j] = frames[j], frames[i]
 	}
-	return &Stacktrace{frames}
+	stacktrace := &Stacktrace{Frames: frames}
+	stacktrace.omitFrames(maxStacktraceFrames())
+	return stacktrace
+}
+
+// The number of frames a stacktrace is limited to when
+// SetMaxStacktraceFrames has not been called.
+const defaultMaxStacktraceFrames = 100
+
+var (
+	maxFramesLock sync.RWMutex
+	maxFrames     int
+)
+
+// SetMaxStacktraceFrames sets the number of frames stacktraces are limited to,
+// so that deep recursion does not make packets too large for Sentry. The
+// innermost frames and a tenth as many of the outermost ones are kept, and the
+// frames in between are left out. Zero restores the default of 100 frames, and
+// a negative value removes the limit.
+func SetMaxStacktraceFrames(n int) {
+	maxFramesLock.Lock()
+	defer maxFramesLock.Unlock()
+	maxFrames = n
+}
+
+func maxStacktraceFrames() int {
+	maxFramesLock.RLock()
+	defer maxFramesLock.RUnlock()
+	if maxFrames == 0 {
+		return defaultMaxStacktraceFrames
+	}
+	return maxFrames
+}
+
+// omitFrames leaves frames out of the middle of the stacktrace until it has
+// at most max, recording the indexes of the ones left out.
+func (s *Stacktrace) omitFrames(max int) {
+	if max < 0 || len(s.Frames) <= max {
+		return
+	}
+	outermost := max / 10
+	end := len(s.Frames) - (max - outermost)
+	s.Frames = append(s.Frames[:outermost:outermost], s.Frames[end:]...)
+	s.FramesOmitted = []int{outermost, end}
 }
 
 // Build a single frame using data returned from runtime.Caller.
@@ -93,8 +275,15 @@ func NewStacktrace(skip int, context int, appPackagePrefixes []string) *Stacktra
 // appPackagePrefixes is a list of prefixes used to check whether a package should
 // be considered "in app".
 func NewStacktraceFrame(pc uintptr, file string, line, context int, appPackagePrefixes []string) *StacktraceFrame {
+	pack, name := functionName(pc)
+	return newStacktraceFrame(pack, name, file, line, context, appPackagePrefixes)
+}
+
+// newStacktraceFrame builds a frame for a call to the function name of
+// package pack.
+func newStacktraceFrame(pack, name, file string, line, context int, appPackagePrefixes []string) *StacktraceFrame {
 	frame := &StacktraceFrame{AbsolutePath: file, Filename: trimPath(file), Lineno: line, InApp: false}
-	frame.Module, frame.Function = functionName(pc)
+	frame.Module, frame.Function = pack, name
 
 	// `runtime.goexit` is effectively a placeholder that comes from
 	// runtime/asm_amd64.s and is meaningless.
@@ -102,14 +291,9 @@ func NewStacktraceFrame(pc uintptr, file string, line, context int, appPackagePr
 		return nil
 	}
 
-	if frame.Module == "main" {
-		frame.InApp = true
-	} else {
-		for _, prefix := range appPackagePrefixes {
-			if strings.HasPrefix(frame.Module, prefix) && !strings.Contains(frame.Module, "vendor") && !strings.Contains(frame.Module, "third_party") {
-				frame.InApp = true
-			}
-		}
+	frame.InApp = isInApp(frame.Module, appPackagePrefixes)
+	if skipsContext(frame.InApp) {
+		return frame
 	}
 
 	if context > 0 {
@@ -135,44 +319,152 @@ func NewStacktraceFrame(pc uintptr, file string, line, context int, appPackagePr
 	return frame
 }
 
+// isInApp reports whether code in module should be considered part of the
+// application rather than a library. The main package always is; any other
+// package must match one of appPackagePrefixes and not be vendored.
+func isInApp(module string, appPackagePrefixes []string) bool {
+	if module == "main" {
+		return true
+	}
+	if strings.Contains(module, "vendor") || strings.Contains(module, "third_party") {
+		return false
+	}
+	for _, prefix := range appPackagePrefixes {
+		if strings.HasPrefix(module, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Retrieve the name of the package and function containing the PC.
 func functionName(pc uintptr) (pack string, name string) {
 	fn := runtime.FuncForPC(pc)
 	if fn == nil {
 		return
 	}
-	name = fn.Name()
+	return splitFunctionName(fn.Name())
+}
+
+// Split a fully qualified function name into its package and name.
+func splitFunctionName(fullName string) (pack string, name string) {
+	name = fullName
 	// We get this:
+	//	github.com/getsentry/raven-go.(*Client).Capture.func1
+	//	github.com/getsentry/raven-go.Map[go.shape.string]
 	//	runtime/debug.*T·ptrmethod
 	// and want this:
-	//  pack = runtime/debug
+	//	pack = github.com/getsentry/raven-go
+	//	name = (*Client).Capture.func1
+	//
+	//	pack = github.com/getsentry/raven-go
+	//	name = Map[go.shape.string]
+	//
+	//	pack = runtime/debug
 	//	name = *T.ptrmethod
-	if idx := strings.LastIndex(name, "."); idx != -1 {
-		pack = name[:idx]
-		name = name[idx+1:]
+	//
+	// The package ends at the first dot after the last slash, as dots in the
+	// last element of its path are escaped. The type arguments of generic
+	// functions may contain slashes, so only the part before them is searched.
+	path := name
+	if idx := strings.Index(path, "["); idx != -1 {
+		path = path[:idx]
+	}
+	start := strings.LastIndex(path, "/") + 1
+	if idx := strings.Index(path[start:], "."); idx != -1 {
+		pack = strings.Replace(name[:start+idx], "%2e", ".", -1)
+		name = name[start+idx+1:]
 	}
 	name = strings.Replace(name, "·", ".", -1)
 	return
 }
 
+// The bounds of the cache of the source files read for the context of frames.
+// Deep stacks usually revisit the same few files, so only the most recently
+// used ones are kept.
+const (
+	fileCacheMaxFiles = 256
+	fileCacheMaxBytes = 16 << 20
+)
+
 var fileCacheLock sync.Mutex
-var fileCache = make(map[string][][]byte)
+var fileCache = newFileLRU()
+
+// A fileLRU holds the lines of source files, evicting the least recently used
+// ones beyond the bounds of the cache.
+type fileLRU struct {
+	entries map[string]*list.Element
+	order   *list.List // of *fileEntry, most recently used first
+	size    int
+}
+
+type fileEntry struct {
+	filename string
+	lines    [][]byte
+	size     int
+}
+
+func newFileLRU() *fileLRU {
+	return &fileLRU{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *fileLRU) len() int { return len(c.entries) }
+
+func (c *fileLRU) get(filename string) ([][]byte, bool) {
+	elem, ok := c.entries[filename]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*fileEntry).lines, true
+}
+
+func (c *fileLRU) add(filename string, lines [][]byte, size int) {
+	c.entries[filename] = c.order.PushFront(&fileEntry{filename, lines, size})
+	c.size += size
+	for c.order.Len() > 1 && (c.order.Len() > fileCacheMaxFiles || c.size > fileCacheMaxBytes) {
+		entry := c.order.Remove(c.order.Back()).(*fileEntry)
+		delete(c.entries, entry.filename)
+		c.size -= entry.size
+	}
+}
+
+// readSourceFile returns the contents of the source file filename. Anything
+// but a regular file, such as a directory or a device that could block, is not
+// read, and neither is a binary file found in place of the source.
+func readSourceFile(filename string) ([]byte, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("raven: %s is not a regular file", filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return nil, fmt.Errorf("raven: %s is not a source file", filename)
+	}
+	return data, nil
+}
 
 func fileContext(filename string, line, context int) ([][]byte, int) {
 	fileCacheLock.Lock()
 	defer fileCacheLock.Unlock()
-	lines, ok := fileCache[filename]
+	lines, ok := fileCache.get(filename)
 	if !ok {
-		data, err := ioutil.ReadFile(filename)
+		data, err := readSourceFile(filename)
 		if err != nil {
 			// cache errors as nil slice: code below handles it correctly
 			// otherwise when missing the source or running as a different user, we try
 			// reading the file on each error which is unnecessary
-			fileCache[filename] = nil
+			fileCache.add(filename, nil, 0)
 			return nil, 0
 		}
 		lines = bytes.Split(data, []byte{'\n'})
-		fileCache[filename] = lines
+		fileCache.add(filename, lines, len(data))
 	}
 
 	if lines == nil {
@@ -190,7 +482,8 @@ func fileContext(filename string, line, context int) ([][]byte, int) {
 		idx = context
 	}
 	end := line + context + 1
-	if line >= len(lines) {
+	if line < 0 || line >= len(lines) {
+		// The line is not in the file, which is not the one built
 		return nil, 0
 	}
 	if end > len(lines) {
@@ -201,17 +494,88 @@ func fileContext(filename string, line, context int) ([][]byte, int) {
 
 var trimPaths []string
 
-// Try to trim the GOROOT or GOPATH prefix off of a filename
+var (
+	sourcePathTrimPrefixesLock sync.RWMutex
+	sourcePathTrimPrefixes     []string
+)
+
+var (
+	contextInAppOnlyLock sync.RWMutex
+	contextInAppOnly     bool
+)
+
+// The import path of this package, used to skip its own frames
+var ravenPackage string
+
+// The directory of the module cache within GOPATH, in which dependencies
+// are stored when building with modules.
+var moduleCacheDir = string(filepath.Separator) + filepath.Join("pkg", "mod") + string(filepath.Separator)
+
+// SetSourcePathTrimPrefixes sets directories, such as the project root on
+// the build machine, which are trimmed from the start of stack frame filenames
+// in preference to the GOPATH and module cache. Passing nil removes them.
+func SetSourcePathTrimPrefixes(prefixes []string) {
+	var trimmed []string
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			continue
+		}
+		if prefix[len(prefix)-1] != filepath.Separator {
+			prefix += string(filepath.Separator)
+		}
+		trimmed = append(trimmed, prefix)
+	}
+
+	sourcePathTrimPrefixesLock.Lock()
+	defer sourcePathTrimPrefixesLock.Unlock()
+	sourcePathTrimPrefixes = trimmed
+}
+
+// SetContextInAppOnly sets whether the source lines around frames are only
+// read for the frames that are in app. The frames of the standard library and
+// other dependencies are then left with just their file, line and function,
+// which saves reading their source and makes packets smaller.
+func SetContextInAppOnly(only bool) {
+	contextInAppOnlyLock.Lock()
+	defer contextInAppOnlyLock.Unlock()
+	contextInAppOnly = only
+}
+
+func skipsContext(inApp bool) bool {
+	if inApp {
+		return false
+	}
+	contextInAppOnlyLock.RLock()
+	defer contextInAppOnlyLock.RUnlock()
+	return contextInAppOnly
+}
+
+// Try to trim a configured prefix, or the GOROOT, GOPATH or module cache
+// prefix off of a filename
 func trimPath(filename string) string {
+	sourcePathTrimPrefixesLock.RLock()
+	prefixes := sourcePathTrimPrefixes
+	sourcePathTrimPrefixesLock.RUnlock()
+
+	for _, prefix := range prefixes {
+		if trimmed := strings.TrimPrefix(filename, prefix); len(trimmed) < len(filename) {
+			return trimmed
+		}
+	}
 	for _, prefix := range trimPaths {
 		if trimmed := strings.TrimPrefix(filename, prefix); len(trimmed) < len(filename) {
 			return trimmed
 		}
 	}
+	if idx := strings.Index(filename, moduleCacheDir); idx >= 0 {
+		return filename[idx+len(moduleCacheDir):]
+	}
 	return filename
 }
 
 func init() {
+	ravenPackage, _ = functionName(reflect.ValueOf(NewStacktrace).Pointer())
+
 	// Collect all source directories, and make sure they
 	// end in a trailing "separator"
 	for _, prefix := range build.Default.SrcDirs() {
@@ -0,0 +1,47 @@
+package raven_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+)
+
+// panicStacktrace calls f and returns the stacktrace of its panic, built by a
+// deferred function outside of the raven package.
+func panicStacktrace(f func()) (st *raven.Stacktrace) {
+	defer func() {
+		recover()
+		st = raven.NewPanicStacktrace(0, nil)
+	}()
+	f()
+	return nil
+}
+
+func TestNewPanicStacktraceFromDeferredFunction(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		f    func()
+	}{
+		{"panic", func() { panic("boom") }},
+		{"nil map", func() {
+			var m map[string]int
+			m["panic"] = 1
+		}},
+	} {
+		st := panicStacktrace(test.f)
+		if st == nil {
+			t.Errorf("%s: got nil stacktrace", test.name)
+			continue
+		}
+		f := st.Frames[len(st.Frames)-1]
+		if !strings.HasPrefix(f.Function, "TestNewPanicStacktraceFromDeferredFunction.func") {
+			t.Errorf("%s: incorrect top frame: got %s.%s", test.name, f.Module, f.Function)
+		}
+		for _, frame := range st.Frames {
+			if frame.Module == "runtime" || strings.HasPrefix(frame.Function, "panicStacktrace.func") {
+				t.Errorf("%s: unexpected frame: %s.%s", test.name, frame.Module, frame.Function)
+			}
+		}
+	}
+}
@@ -145,7 +145,7 @@ func TestNewStacktrace_noFrames(t *testing.T) {
 
 func TestFileContext(t *testing.T) {
 	// reset the cache
-	fileCache = make(map[string][][]byte)
+	fileCache = newFileLRU()
 
 	tempdir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -181,8 +181,318 @@ func TestFileContext(t *testing.T) {
 			t.Errorf("%d: fileContext(%#v, 1, 0) = %v, %v; expected len()=%d, %d",
 				i, test.path, lines, index, test.expectedLines, test.expectedIndex)
 		}
-		if len(fileCache) != i+1 {
-			t.Errorf("%d: result was not cached; len(fileCached)=%d", i, len(fileCache))
+		if fileCache.len() != i+1 {
+			t.Errorf("%d: result was not cached; len(fileCached)=%d", i, fileCache.len())
 		}
 	}
 }
+
+func TestNewPanicStacktrace(t *testing.T) {
+	var st *Stacktrace
+	func() {
+		defer func() {
+			recover()
+			st = NewPanicStacktrace(0, nil)
+		}()
+		var m map[string]int
+		m["panic"] = 1
+	}()
+
+	if st == nil {
+		t.Fatal("got nil stacktrace")
+	}
+	f := st.Frames[len(st.Frames)-1]
+	if actual, expected := f.Module+"."+f.Function, thisPackage+".TestNewPanicStacktrace.func1"; actual != expected {
+		t.Errorf("incorrect top frame: got %s, want %s", actual, expected)
+	}
+	for _, frame := range st.Frames {
+		if frame.Module == "runtime" {
+			t.Errorf("unexpected runtime frame: %s", frame.Function)
+		}
+	}
+}
+
+func TestIsInApp(t *testing.T) {
+	prefixes := []string{"github.com/myco/app"}
+	for _, test := range []struct {
+		module string
+		inApp  bool
+	}{
+		{"main", true},
+		{"github.com/myco/app", true},
+		{"github.com/myco/app/internal/billing", true},
+		{"github.com/myco/app/server.(*Server)", true},
+		{"github.com/lib/pq", false},
+		{"github.com/myco/app/vendor/github.com/lib/pq", false},
+		{"net/http", false},
+	} {
+		if actual := isInApp(test.module, prefixes); actual != test.inApp {
+			t.Errorf("incorrect in_app for %s: got %t, want %t", test.module, actual, test.inApp)
+		}
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	srcDirs := build.Default.SrcDirs()
+	if len(srcDirs) == 0 {
+		t.Skip("no source directories")
+	}
+	src := srcDirs[len(srcDirs)-1]
+	root := filepath.Join(string(filepath.Separator), "home", "ci", "build")
+
+	for _, test := range []struct {
+		name     string
+		filename string
+		expected string
+	}{
+		{"gopath", filepath.Join(src, "github.com", "myco", "app", "main.go"), filepath.Join("github.com", "myco", "app", "main.go")},
+		{"modules", filepath.Join(string(filepath.Separator), "home", "ci", "go", "pkg", "mod", "github.com", "lib", "pq@v1.0.0", "conn.go"), filepath.Join("github.com", "lib", "pq@v1.0.0", "conn.go")},
+		{"configured", filepath.Join(root, "cmd", "app", "main.go"), filepath.Join("cmd", "app", "main.go")},
+		{"other", filepath.Join(string(filepath.Separator), "opt", "main.go"), filepath.Join(string(filepath.Separator), "opt", "main.go")},
+	} {
+		SetSourcePathTrimPrefixes([]string{root})
+		if actual := trimPath(test.filename); actual != test.expected {
+			t.Errorf("%s: incorrect filename: got %s, want %s", test.name, actual, test.expected)
+		}
+	}
+	SetSourcePathTrimPrefixes(nil)
+
+	filename := filepath.Join(root, "cmd", "app", "main.go")
+	if actual := trimPath(filename); actual != filename {
+		t.Errorf("incorrect filename after reset: got %s, want %s", actual, filename)
+	}
+}
+
+// Mirrors the stack trace types of github.com/pkg/errors.
+type testFrame uintptr
+
+type testStackError struct {
+	stack []testFrame
+}
+
+func (e *testStackError) Error() string { return "stack error" }
+
+func (e *testStackError) StackTrace() []testFrame { return e.stack }
+
+type testCauseError struct {
+	cause error
+}
+
+func (e *testCauseError) Error() string { return "wrapped: " + e.cause.Error() }
+
+func (e *testCauseError) Cause() error { return e.cause }
+
+func newTestStackError() error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	err := &testStackError{}
+	for _, pc := range pcs[:n] {
+		err.stack = append(err.stack, testFrame(pc))
+	}
+	return err
+}
+
+func TestNewStacktraceFromError(t *testing.T) {
+	if st := NewStacktraceFromError(fmt.Errorf("no stack"), 0, nil); st != nil {
+		t.Errorf("unexpected stacktrace for an error without one: %v", st)
+	}
+
+	err := &testCauseError{newTestStackError()}
+	st := NewStacktraceFromError(err, 0, nil)
+	if st == nil {
+		t.Fatal("missing stacktrace")
+	}
+	f := st.Frames[len(st.Frames)-1]
+	if actual, expected := f.Module+"."+f.Function, thisPackage+".newTestStackError"; actual != expected {
+		t.Errorf("incorrect top frame: got %s, want %s", actual, expected)
+	}
+	f = st.Frames[len(st.Frames)-2]
+	if actual, expected := f.Module+"."+f.Function, thisPackage+".TestNewStacktraceFromError"; actual != expected {
+		t.Errorf("incorrect caller frame: got %s, want %s", actual, expected)
+	}
+}
+
+func TestSplitFunctionName(t *testing.T) {
+	for _, test := range []struct {
+		fullName string
+		pack     string
+		name     string
+	}{
+		{"main.main", "main", "main"},
+		{"github.com/getsentry/raven-go.CaptureError", "github.com/getsentry/raven-go", "CaptureError"},
+		{"github.com/getsentry/raven-go.(*Client).Capture", "github.com/getsentry/raven-go", "(*Client).Capture"},
+		{"github.com/getsentry/raven-go.Client.URL", "github.com/getsentry/raven-go", "Client.URL"},
+		{"main.main.func1", "main", "main.func1"},
+		{"app/worker.(*Worker).run.func2.1", "app/worker", "(*Worker).run.func2.1"},
+		{"app/worker.Map[...]", "app/worker", "Map[...]"},
+		{"app/worker.Map[go.shape.string]", "app/worker", "Map[go.shape.string]"},
+		{"app/worker.Map[app/models.Order].func1", "app/worker", "Map[app/models.Order].func1"},
+		{"app/worker.(*Pool[...]).Run", "app/worker", "(*Pool[...]).Run"},
+		{"gopkg.in/yaml%2ev2.Marshal", "gopkg.in/yaml.v2", "Marshal"},
+		{"runtime/debug.*T·ptrmethod", "runtime/debug", "*T.ptrmethod"},
+		{"panic", "", "panic"},
+	} {
+		pack, name := splitFunctionName(test.fullName)
+		if pack != test.pack || name != test.name {
+			t.Errorf("incorrect split of %s: got (%s, %s), want (%s, %s)", test.fullName, pack, name, test.pack, test.name)
+		}
+	}
+}
+
+func TestFileContextEviction(t *testing.T) {
+	defer func() { fileCache = newFileLRU() }()
+	fileCache = newFileLRU()
+
+	for i := 0; i < fileCacheMaxFiles+10; i++ {
+		fileContext(fmt.Sprintf("/nonexistent/%d.go", i), 1, 0)
+	}
+	if fileCache.len() != fileCacheMaxFiles {
+		t.Errorf("incorrect number of cached files: got %d, want %d", fileCache.len(), fileCacheMaxFiles)
+	}
+	if _, ok := fileCache.get("/nonexistent/0.go"); ok {
+		t.Error("least recently used file was not evicted")
+	}
+
+	fileCache.add("big", nil, fileCacheMaxBytes)
+	fileCache.add("bigger", nil, 1)
+	if _, ok := fileCache.get("big"); ok || fileCache.size > fileCacheMaxBytes {
+		t.Errorf("cache exceeds its size: got %d bytes", fileCache.size)
+	}
+}
+
+func recursiveStacktrace(depth int) *Stacktrace {
+	if depth == 0 {
+		return NewStacktrace(0, 3, []string{thisPackage})
+	}
+	return recursiveStacktrace(depth - 1)
+}
+
+// BenchmarkNewStacktraceRecursive compares a stack revisiting the same file
+// with its source already cached, and read once for the stacktrace.
+func BenchmarkNewStacktraceRecursive(b *testing.B) {
+	b.Run("warm", func(b *testing.B) {
+		recursiveStacktrace(50)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			recursiveStacktrace(50)
+		}
+	})
+	b.Run("cold", func(b *testing.B) {
+		defer func() { fileCache = newFileLRU() }()
+		for i := 0; i < b.N; i++ {
+			fileCacheLock.Lock()
+			fileCache = newFileLRU()
+			fileCacheLock.Unlock()
+			recursiveStacktrace(50)
+		}
+	})
+}
+
+func TestSetContextInAppOnly(t *testing.T) {
+	SetContextInAppOnly(true)
+	defer SetContextInAppOnly(false)
+
+	st := NewStacktrace(0, 3, []string{thisPackage})
+	inApp, library := 0, 0
+	for _, frame := range st.Frames {
+		if frame.InApp {
+			inApp++
+			if frame.ContextLine == "" || len(frame.PreContext) == 0 {
+				t.Errorf("in app frame %s.%s has no context", frame.Module, frame.Function)
+			}
+			continue
+		}
+		library++
+		if frame.ContextLine != "" || frame.PreContext != nil || frame.PostContext != nil {
+			t.Errorf("library frame %s.%s has context", frame.Module, frame.Function)
+		}
+		if frame.Filename == "" || frame.Lineno == 0 || frame.Function == "" {
+			t.Errorf("incomplete library frame: %+v", frame)
+		}
+	}
+	if inApp == 0 || library == 0 {
+		t.Fatalf("incorrect frames: got %d in app and %d library frames", inApp, library)
+	}
+}
+
+func TestMissingSourceContext(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal("failed to create temporary directory:", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	binaryPath := filepath.Join(tempdir, "binary.go")
+	if err := ioutil.WriteFile(binaryPath, []byte("package main\n\x00\x01\x02\n"), 0600); err != nil {
+		t.Fatal("failed writing file:", err)
+	}
+	shortPath := filepath.Join(tempdir, "short.go")
+	if err := ioutil.WriteFile(shortPath, []byte("package main\n"), 0600); err != nil {
+		t.Fatal("failed writing file:", err)
+	}
+
+	for _, test := range []struct {
+		path string
+		line int
+	}{
+		{filepath.Join(tempdir, "nonexistent", "main.go"), 10},
+		{tempdir, 1},
+		{binaryPath, 1},
+		{shortPath, 10},
+		{shortPath, 0},
+	} {
+		frame := newStacktraceFrame("main", "main", test.path, test.line, 3, nil)
+		if frame.ContextLine != "" || frame.PreContext != nil || frame.PostContext != nil {
+			t.Errorf("frame of %s:%d has context: %+v", test.path, test.line, frame)
+		}
+
+		j, err := NewPacket("boom", &Stacktrace{Frames: []*StacktraceFrame{frame}}).JSON()
+		if err != nil {
+			t.Fatalf("JSON marshalling should not fail: %v", err)
+		}
+		expected := fmt.Sprintf(`{"filename":"%s","function":"main","module":"main","lineno":%d,"abs_path":"%[1]s","in_app":true}`, test.path, test.line)
+		if test.line == 0 {
+			expected = fmt.Sprintf(`{"filename":"%s","function":"main","module":"main","abs_path":"%[1]s","in_app":true}`, test.path)
+		}
+		if !strings.Contains(string(j), expected) {
+			t.Errorf("incorrect frame of %s:%d: got %s, want %s", test.path, test.line, j, expected)
+		}
+	}
+}
+
+func TestSetMaxStacktraceFrames(t *testing.T) {
+	defer SetMaxStacktraceFrames(0)
+
+	frames := func() []*StacktraceFrame {
+		// Ordered with the most recent call first, as by callerFrames
+		frames := make([]*StacktraceFrame, 500)
+		for i := range frames {
+			frames[i] = &StacktraceFrame{Function: fmt.Sprintf("f%d", len(frames)-1-i)}
+		}
+		return frames
+	}
+
+	st := newStacktrace(frames())
+	if len(st.Frames) != defaultMaxStacktraceFrames {
+		t.Fatalf("incorrect number of frames: got %d, want %d", len(st.Frames), defaultMaxStacktraceFrames)
+	}
+	if st.Frames[0].Function != "f0" || st.Frames[9].Function != "f9" {
+		t.Errorf("outermost frames were not kept: got %s to %s", st.Frames[0].Function, st.Frames[9].Function)
+	}
+	if st.Frames[10].Function != "f410" || st.Frames[99].Function != "f499" {
+		t.Errorf("innermost frames were not kept: got %s to %s", st.Frames[10].Function, st.Frames[99].Function)
+	}
+	if len(st.FramesOmitted) != 2 || st.FramesOmitted[0] != 10 || st.FramesOmitted[1] != 410 {
+		t.Errorf("incorrect omitted frames: got %v, want [10 410]", st.FramesOmitted)
+	}
+
+	SetMaxStacktraceFrames(-1)
+	if st := newStacktrace(frames()); len(st.Frames) != 500 || st.FramesOmitted != nil {
+		t.Errorf("stacktrace was limited without a maximum: got %d frames, omitted %v", len(st.Frames), st.FramesOmitted)
+	}
+
+	SetMaxStacktraceFrames(5)
+	if st := newStacktrace(frames()); len(st.Frames) != 5 || st.Frames[0].Function != "f495" {
+		t.Errorf("incorrect frames with a maximum of 5: got %d frames from %s", len(st.Frames), st.Frames[0].Function)
+	}
+}
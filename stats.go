@@ -0,0 +1,152 @@
+package raven
+
+import "time"
+
+// countDelivery counts the outcome of sending a packet.
+func (client *Client) countDelivery(err error) {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	switch err {
+	case nil:
+		client.sent++
+	case ErrRateLimited:
+		client.rateLimited++
+	default:
+		client.failed++
+	}
+}
+
+// SentEvents returns the number of events the client sent to the Sentry
+// server.
+func (client *Client) SentEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.sent
+}
+
+func SentEvents() uint64 { return DefaultClient.SentEvents() }
+
+// FailedEvents returns the number of events the client failed to send, other
+// than because it was rate limited.
+func (client *Client) FailedEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.failed
+}
+
+func FailedEvents() uint64 { return DefaultClient.FailedEvents() }
+
+// RateLimitedEvents returns the number of events the client did not send
+// because the Sentry server rate limited it.
+func (client *Client) RateLimitedEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.rateLimited
+}
+
+func RateLimitedEvents() uint64 { return DefaultClient.RateLimitedEvents() }
+
+// SampledOutEvents returns the number of events the client did not send
+// because of its sample rate.
+func (client *Client) SampledOutEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.sampledOut
+}
+
+func SampledOutEvents() uint64 { return DefaultClient.SampledOutEvents() }
+
+// SanitizedTags returns the number of tags the client changed to meet the
+// constraints of Sentry on their keys and values, or left out because their
+// key collided with that of another tag once changed.
+func (client *Client) SanitizedTags() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.sanitizedTags
+}
+
+func SanitizedTags() uint64 { return DefaultClient.SanitizedTags() }
+
+// OversizedEvents returns the number of events the client did not send
+// because they were larger than SetMaxPacketBytes allows, even once trimmed.
+func (client *Client) OversizedEvents() uint64 {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.oversized
+}
+
+func OversizedEvents() uint64 { return DefaultClient.OversizedEvents() }
+
+// Stats is a snapshot of the counts of the events captured by a client, by
+// outcome, and of the state of its queue.
+type Stats struct {
+	// Events sent to the Sentry server, and events that failed to be sent
+	Sent   uint64
+	Failed uint64
+
+	// Events that were not sent, because the Sentry server rate limited the
+	// client, because of the sample rate, because the queue was full,
+	// because they were duplicates and because they were too large
+	RateLimited uint64
+	SampledOut  uint64
+	Dropped     uint64
+	Suppressed  uint64
+	Oversized   uint64
+
+	// The number of events waiting in the queue to be sent
+	QueueLength int
+
+	// Tags whose key or value was changed to meet the constraints of Sentry
+	SanitizedTags uint64
+
+	// The time until which the Sentry server asked for no events to be sent,
+	// or the zero time if it is not rate limiting the client, and the state of
+	// the circuit breaker for the client's URL. Both are only known for
+	// transports reporting them, such as HTTPTransport.
+	RateLimitedUntil time.Time
+	CircuitState     CircuitState
+}
+
+// Stats returns a snapshot of the counts of the events captured by the client,
+// and of the state of its transport for the client's URL. The counts are read
+// together, so they are consistent with each other, while the state of the
+// transport is read right after them.
+func (client *Client) Stats() Stats {
+	client.mu.RLock()
+	url, transport := client.url, client.Transport
+	client.mu.RUnlock()
+
+	client.statsMu.Lock()
+	stats := Stats{
+		Sent:        client.sent,
+		Failed:      client.failed,
+		RateLimited: client.rateLimited,
+		SampledOut:  client.sampledOut,
+		Dropped:     client.dropped,
+		Suppressed:  client.suppressed,
+		Oversized:   client.oversized,
+		QueueLength: len(client.queue),
+
+		SanitizedTags: client.sanitizedTags,
+	}
+	client.statsMu.Unlock()
+
+	if limiter, ok := transport.(interface {
+		RateLimitedUntil(url string) time.Time
+	}); ok {
+		stats.RateLimitedUntil = limiter.RateLimitedUntil(url)
+	}
+	if breaker, ok := transport.(interface {
+		CircuitState(url string) CircuitState
+	}); ok {
+		stats.CircuitState = breaker.CircuitState(url)
+	}
+	return stats
+}
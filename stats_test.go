@@ -0,0 +1,77 @@
+package raven
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventCounters(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	client.Capture(NewPacket("sent"), nil)
+	client.Capture(NewPacket("sent"), nil)
+	client.Wait()
+
+	transport.err = errors.New("connection refused")
+	client.Capture(NewPacket("failed"), nil)
+	client.Wait()
+
+	transport.err = ErrRateLimited
+	client.Capture(NewPacket("rate limited"), nil)
+	client.Wait()
+
+	client.SetSampleRate(0)
+	client.Capture(NewPacket("sampled out"), nil)
+	client.Wait()
+
+	for _, counter := range []struct {
+		name     string
+		actual   uint64
+		expected uint64
+	}{
+		{"SentEvents", client.SentEvents(), 2},
+		{"FailedEvents", client.FailedEvents(), 1},
+		{"RateLimitedEvents", client.RateLimitedEvents(), 1},
+		{"SampledOutEvents", client.SampledOutEvents(), 1},
+		{"DroppedEvents", client.DroppedEvents(), 0},
+	} {
+		if counter.actual != counter.expected {
+			t.Errorf("incorrect %s: got %d, want %d", counter.name, counter.actual, counter.expected)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	transport := newBlockingTransport()
+	client.Transport = transport
+
+	client.Capture(NewPacket("sent"), nil)
+	<-transport.started
+	client.Capture(NewPacket("queued"), nil)
+	if stats := client.Stats(); stats.QueueLength != 1 {
+		t.Errorf("incorrect QueueLength while sending: got %d, want 1", stats.QueueLength)
+	}
+	transport.release <- struct{}{}
+	<-transport.started
+	transport.err = errors.New("connection refused")
+	transport.release <- struct{}{}
+	client.Wait()
+
+	now := time.Now()
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+	httpTransport := &HTTPTransport{blockedUntil: map[string]time.Time{client.URL(): now.Add(time.Minute)}}
+	client.Transport = httpTransport
+	client.CaptureMessageAndWait("rate limited", nil)
+
+	expected := Stats{Sent: 1, Failed: 1, RateLimited: 1, RateLimitedUntil: now.Add(time.Minute)}
+	if stats := client.Stats(); stats != expected {
+		t.Errorf("incorrect Stats: got %+v, want %+v", stats, expected)
+	}
+
+	httpTransport.circuits = map[string]*circuit{client.URL(): {failures: defaultCircuitThreshold, openUntil: now.Add(time.Minute)}}
+	if stats := client.Stats(); stats.CircuitState != CircuitOpen {
+		t.Errorf("incorrect CircuitState: got %s, want %s", stats.CircuitState, CircuitOpen)
+	}
+}
@@ -1,5 +1,9 @@
 package raven
 
+import (
+	"strings"
+)
+
 type Writer struct {
 	Client *Client
 	Level  Severity
@@ -11,10 +15,113 @@ type Writer struct {
 func (w *Writer) Write(p []byte) (int, error) {
 	message := string(p)
 
-	packet := NewPacket(message, &Message{message, nil})
+	packet := NewPacket(message, &Message{Message: message})
 	packet.Level = w.Level
 	packet.Logger = w.Logger
 	w.Client.Capture(packet, nil)
 
 	return len(p), nil
 }
+
+// A LogWriter forwards the lines written by a log.Logger to Sentry as message
+// events, so that it can be used with log.SetOutput. Lines are captured
+// asynchronously, so writing does not wait for them to be sent.
+//
+// A line may start with the date and time written by the logger, which are
+// skipped, followed by a level token such as ERROR, [WARN] or info: setting
+// the severity of the event. Lines without one have the severity Level.
+type LogWriter struct {
+	Client *Client  // Defaults to DefaultClient
+	Level  Severity // Defaults to ERROR
+	Logger string   // Logger name reported to Sentry
+
+	// Lines with a lower severity are not forwarded. The zero value forwards
+	// every line.
+	MinLevel Severity
+}
+
+// Write sends the log line p to Sentry, unless its severity is lower than
+// MinLevel. It always succeeds.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	level, message := parseLogLine(string(p))
+	if level == "" {
+		level = w.Level
+	}
+	if level == "" {
+		level = ERROR
+	}
+	if severityRank(level) < severityRank(w.MinLevel) {
+		return len(p), nil
+	}
+
+	client := w.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	packet := NewPacket(message, &Message{Message: message})
+	packet.Level = level
+	packet.Logger = w.Logger
+	client.Capture(packet, nil)
+
+	return len(p), nil
+}
+
+var logLevelTokens = map[string]Severity{
+	"DEBUG":    DEBUG,
+	"INFO":     INFO,
+	"WARN":     WARNING,
+	"WARNING":  WARNING,
+	"ERROR":    ERROR,
+	"ERR":      ERROR,
+	"FATAL":    FATAL,
+	"CRITICAL": FATAL,
+	"PANIC":    FATAL,
+}
+
+// parseLogLine returns the severity given by the level token at the start of
+// line, if any, and the message following it. The date and time written by a
+// log.Logger before the token are left out of the message.
+func parseLogLine(line string) (Severity, string) {
+	line = strings.TrimRight(line, "\r\n")
+	rest := strings.TrimLeft(line, " ")
+	for {
+		word, after := splitWord(rest)
+		if !strings.ContainsAny(word, "/:") || strings.Trim(word, "0123456789/:.") != "" {
+			break
+		}
+		rest = after
+	}
+
+	word, after := splitWord(rest)
+	token := strings.ToUpper(strings.TrimSuffix(strings.Trim(word, "[]"), ":"))
+	if level, ok := logLevelTokens[token]; ok {
+		return level, after
+	}
+	return "", rest
+}
+
+// splitWord splits s after its first space-separated word.
+func splitWord(s string) (word, rest string) {
+	if idx := strings.IndexByte(s, ' '); idx >= 0 {
+		return s[:idx], strings.TrimLeft(s[idx:], " ")
+	}
+	return s, ""
+}
+
+// severityRank orders severities from DEBUG up to FATAL. Unknown severities,
+// including the empty one, rank below DEBUG.
+func severityRank(level Severity) int {
+	switch level {
+	case DEBUG:
+		return 1
+	case INFO:
+		return 2
+	case WARNING:
+		return 3
+	case ERROR:
+		return 4
+	case FATAL:
+		return 5
+	}
+	return 0
+}
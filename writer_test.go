@@ -0,0 +1,59 @@
+package raven
+
+import (
+	"log"
+	"testing"
+)
+
+var parseLogLineTests = []struct {
+	line    string
+	level   Severity
+	message string
+}{
+	{"ERROR connection refused\n", ERROR, "connection refused"},
+	{"2009/11/10 23:00:00 WARN disk almost full\n", WARNING, "disk almost full"},
+	{"2009/11/10 23:00:00.123456 [info] started\n", INFO, "started"},
+	{"debug: cache miss", DEBUG, "cache miss"},
+	{"2009/11/10 23:00:00 something happened\n", "", "something happened"},
+	{"500 errors per second", "", "500 errors per second"},
+}
+
+func TestParseLogLine(t *testing.T) {
+	for _, test := range parseLogLineTests {
+		level, message := parseLogLine(test.line)
+		if level != test.level || message != test.message {
+			t.Errorf("incorrect parse of %q: got (%q, %q), want (%q, %q)", test.line, level, message, test.level, test.message)
+		}
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	client, transport := newRecordingClient(t)
+	logger := log.New(&LogWriter{Client: client, Level: WARNING, MinLevel: WARNING, Logger: "stdlib"}, "", log.LstdFlags)
+	logger.Print("DEBUG cache miss")
+	logger.Print("INFO started")
+	logger.Print("ERROR connection refused")
+	logger.Print("something happened")
+	client.Wait()
+
+	packets := transport.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets: got %d, want 2", len(packets))
+	}
+	for i, expected := range []struct {
+		level   Severity
+		message string
+	}{
+		{ERROR, "connection refused"},
+		{WARNING, "something happened"},
+	} {
+		// Packets are sent in order by the client's single worker
+		packet := packets[i]
+		if packet.Level != expected.level || packet.Message != expected.message {
+			t.Errorf("incorrect packet %d: got (%s, %q), want (%s, %q)", i, packet.Level, packet.Message, expected.level, expected.message)
+		}
+		if packet.Logger != "stdlib" {
+			t.Errorf("incorrect Logger: got %s, want stdlib", packet.Logger)
+		}
+	}
+}